@@ -186,7 +186,9 @@ func runBin(ctx *cli.Context) {
 		movePath = path.Join(runtime.GOROOT(), "pkg/tool", runtime.GOOS+"_"+runtime.GOARCH)
 		if !base.IsExist(binPath) {
 			log.Info("Command executed successfully!")
-			fmt.Println("Binary has been built into: " + movePath)
+			if !log.Quiet {
+				fmt.Println("Binary has been built into: " + movePath)
+			}
 			return
 		}
 	}
@@ -222,5 +224,7 @@ func runBin(ctx *cli.Context) {
 	}
 
 	log.Info("Command executed successfully!")
-	fmt.Println("Binary has been built into: " + movePath)
+	if !log.Quiet {
+		fmt.Println("Binary has been built into: " + movePath)
+	}
 }
@@ -17,7 +17,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
+	"strings"
 
 	"github.com/gpmgo/gopm/modules/base"
 	"github.com/gpmgo/gopm/modules/cli"
@@ -29,8 +31,8 @@ import (
 var CmdBuild = cli.Command{
 	Name:  "build",
 	Usage: "link dependencies and go build",
-	Description: `Command build links dependencies according to gopmfile,
-and execute 'go build'
+	Description: `Command build fetches missing dependencies and links them
+according to gopmfile, and execute 'go build'
 
 gopm build <go build commands>`,
 	Action: runBuild,
@@ -40,22 +42,111 @@ gopm build <go build commands>`,
 		cli.BoolFlag{"remote, r", "build with packages in gopm local repository only", ""},
 		cli.BoolFlag{"verbose, v", "show process details", ""},
 		cli.StringFlag{"o", "output", "specifies the output file name", ""},
+		cli.StringFlag{"goos", "", "target operating system for cross-compiling", ""},
+		cli.StringFlag{"goarch", "", "target architecture for cross-compiling", ""},
+		cli.StringFlag{"gobin", "", "path of go binary to build with", ""},
 	},
 }
 
+// distList returns supported targets of given go binary,
+// keyed by operating system and architecture like 'linux/amd64'.
+func distList(gobin string) (map[string]bool, error) {
+	data, err := exec.Command(gobin, "tool", "dist", "list").Output()
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]bool)
+	for _, target := range strings.Fields(string(data)) {
+		targets[target] = true
+	}
+	return targets, nil
+}
+
+// validTarget returns error if given target is not supported,
+// either of them can be empty which means it is not given.
+func validTarget(targets map[string]bool, goos, goarch string) error {
+	var hasOS, hasArch bool
+	for target := range targets {
+		infos := strings.SplitN(target, "/", 2)
+		if len(infos) != 2 {
+			continue
+		}
+		switch {
+		case infos[0] == goos && infos[1] == goarch:
+			return nil
+		case infos[0] == goos:
+			hasOS = true
+		case infos[1] == goarch:
+			hasArch = true
+		}
+	}
+	switch {
+	case len(goos) > 0 && !hasOS:
+		return fmt.Errorf("unknown target operating system: %s", goos)
+	case len(goarch) > 0 && !hasArch:
+		return fmt.Errorf("unknown target architecture: %s", goarch)
+	case len(goos) > 0 && len(goarch) > 0:
+		return fmt.Errorf("unsupported target: %s/%s", goos, goarch)
+	}
+	return nil
+}
+
+// buildEnv validates cross-compiling options and returns
+// go binary and extra environment variables to build with.
+func buildEnv(ctx *cli.Context) (string, []string, error) {
+	gobin := "go"
+	if len(ctx.String("gobin")) > 0 {
+		gobin = ctx.String("gobin")
+	}
+	gobin, err := exec.LookPath(gobin)
+	if err != nil {
+		return "", nil, fmt.Errorf("go binary is not found: %v", err)
+	}
+
+	env := make([]string, 0, 2)
+	goos, goarch := ctx.String("goos"), ctx.String("goarch")
+	if len(goos) == 0 && len(goarch) == 0 {
+		return gobin, env, nil
+	}
+	// Targets are only known by go binary itself, old one may not tell.
+	if targets, err := distList(gobin); err != nil {
+		log.Warn("Fail to list supported targets, skip validation: %v", err)
+	} else if err = validTarget(targets, goos, goarch); err != nil {
+		return "", nil, err
+	}
+	if len(goos) > 0 {
+		env = append(env, "GOOS="+goos)
+	}
+	if len(goarch) > 0 {
+		env = append(env, "GOARCH="+goarch)
+	}
+	return gobin, env, nil
+}
+
 func buildBinary(ctx *cli.Context, args ...string) error {
 	_, target, err := parseGopmfile(setting.GOPMFILE)
 	if err != nil {
 		return err
 	}
 
+	// Fail early before fetching anything.
+	gobin, env, err := buildEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Make sure all dependencies have been fetched.
+	if err := getByGopmfile(ctx, nil); err != nil {
+		return fmt.Errorf("fail to get dependencies: %v", err)
+	}
+
 	if err := linkVendors(ctx, ""); err != nil {
 		return err
 	}
 
 	log.Info("Building...")
 
-	cmdArgs := append([]string{"go", "build"})
+	cmdArgs := append([]string{gobin, "build"})
 
 	// Set output binary name
 	cmdArgs = append(cmdArgs, "-o")
@@ -74,7 +165,7 @@ func buildBinary(ctx *cli.Context, args ...string) error {
 
 	log.Debug("Args: %v", cmdArgs)
 
-	if err := execCmd(setting.DefaultVendor, setting.WorkDir, cmdArgs...); err != nil {
+	if err := execCmdEnv(setting.DefaultVendor, setting.WorkDir, env, cmdArgs...); err != nil {
 		return fmt.Errorf("fail to build program: %v", err)
 	}
 
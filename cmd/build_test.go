@@ -0,0 +1,44 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestValidTarget(t *testing.T) {
+	targets := map[string]bool{"linux/amd64": true, "linux/arm64": true, "windows/amd64": true, "js/wasm": true}
+	tests := []struct {
+		goos, goarch string
+		isValid      bool
+	}{
+		{"", "", true},
+		{"linux", "", true},
+		{"", "wasm", true},
+		{"windows", "amd64", true},
+		{"js", "wasm", true},
+		{"plan10", "", false},
+		{"", "z80", false},
+		{"windows", "wasm", false},
+		{"linux", "z80", false},
+	}
+	for _, test := range tests {
+		if err := validTarget(targets, test.goos, test.goarch); test.isValid && err != nil {
+			t.Errorf("validTarget(%q, %q): unexpected error: %v", test.goos, test.goarch, err)
+		} else if !test.isValid && err == nil {
+			t.Errorf("validTarget(%q, %q): expect error, got nil", test.goos, test.goarch)
+		}
+	}
+}
@@ -15,11 +15,14 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path"
 
+	"github.com/gpmgo/gopm/modules/base"
 	"github.com/gpmgo/gopm/modules/cli"
 	"github.com/gpmgo/gopm/modules/errors"
+	"github.com/gpmgo/gopm/modules/log"
 	"github.com/gpmgo/gopm/modules/setting"
 )
 
@@ -28,10 +31,14 @@ var CmdClean = cli.Command{
 	Usage: "clean all temporary files",
 	Description: `Command clean deletes all temporary files generated by gopm
 
-gopm clean`,
+gopm clean
+gopm clean -n
+
+Use '--dry-run, -n' to show what would be deleted without deleting anything.`,
 	Action: runClean,
 	Flags: []cli.Flag{
 		cli.BoolFlag{"all, a", "delete all files in local repository", ""},
+		cli.BoolFlag{"dry-run, n", "show what would be deleted only", ""},
 		cli.BoolFlag{"verbose, v", "show process details", ""},
 	},
 }
@@ -42,9 +49,35 @@ func runClean(ctx *cli.Context) {
 		return
 	}
 
-	os.RemoveAll(path.Join(setting.HomeDir, ".gopm/temp"))
+	paths := []string{path.Join(setting.HomeDir, ".gopm/temp")}
 	if ctx.Bool("all") {
-		os.Remove(path.Join(setting.HomeDir, ".gopm/data/localnodes.list"))
-		os.RemoveAll(setting.InstallRepoPath)
+		paths = append(paths,
+			path.Join(setting.HomeDir, ".gopm/data/localnodes.list"),
+			setting.InstallRepoPath)
+	}
+
+	var total int64
+	for _, p := range paths {
+		if !base.IsExist(p) {
+			continue
+		}
+		size := base.DirSize(p)
+		if ctx.Bool("dry-run") {
+			fmt.Printf("Would delete %s (%d bytes)\n", p, size)
+			total += size
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			errors.AppendError(fmt.Errorf("fail to delete %s: %v", p, err))
+			continue
+		}
+		total += size
+	}
+
+	switch {
+	case ctx.Bool("dry-run"):
+		fmt.Printf("%d bytes would be freed\n", total)
+	case !log.Quiet:
+		fmt.Printf("%d bytes freed\n", total)
 	}
 }
@@ -16,12 +16,15 @@ package cmd
 
 import (
 	"fmt"
+	"go/build"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/gpmgo/gopm/modules/base"
 	"github.com/gpmgo/gopm/modules/cli"
@@ -31,11 +34,73 @@ import (
 	"github.com/gpmgo/gopm/modules/setting"
 )
 
+// GlobalFlags are flags shared by all commands.
+var GlobalFlags = []cli.Flag{
+	cli.BoolFlag{"noterm, n", "disable color output", ""},
+	cli.StringFlag{"color", "auto", "when to use color output: auto, always or never", ""},
+	cli.BoolFlag{"strict, s", "strict mode", ""},
+	cli.BoolFlag{"debug, d", "debug mode", ""},
+	cli.BoolFlag{"json", "print results of get and info commands in JSON format", ""},
+	cli.BoolFlag{"quiet, q", "print errors only, results in JSON format are still printed", ""},
+	cli.BoolFlag{"refresh", "ignore cached metadata of packages and fetch again", ""},
+	cli.BoolFlag{"insecure", "skip TLS verification and allow plain HTTP, for self-hosted mirrors only", ""},
+	cli.StringFlag{"auth", "", "credentials of private registry and mirrors, 'user:pass' or Authorization header value", ""},
+	cli.StringFlag{"mirrors", "", "comma-separated base URLs of registry mirrors to try in order, file:// for local directory, overrides config file", ""},
+	cli.StringFlag{"proxy", "", "HTTP proxy to use, overrides config file and environment", ""},
+	cli.StringFlag{"repos", "", "path of gopm local repository, overrides GOPM_REPOS environment and config file", ""},
+	cli.StringFlag{"gopath", "", "GOPATH to install packages into, overrides environment and config file", ""},
+	cli.Float64Flag{"ratelimit", 0, "maximum requests per second to each host, 0 for unlimited", ""},
+	cli.DurationFlag{"timeout", 5 * time.Minute, "abort download when no data received for given duration, overrides config file", ""},
+}
+
+// selectGopath returns the GOPATH entry to install packages into.
+// When there are multiple entries, the first writable one is chosen,
+// and it returns empty string if none of them is writable.
+func selectGopath(gopaths []string) string {
+	for i := range gopaths {
+		gopaths[i] = strings.Replace(base.ExpandHome(gopaths[i], setting.HomeDir), "\\", "/", -1)
+	}
+	switch {
+	case len(gopaths) == 0:
+		return ""
+	case len(gopaths) == 1:
+		return gopaths[0]
+	}
+
+	for _, gopath := range gopaths {
+		if base.IsWritableDir(gopath) {
+			return gopath
+		}
+	}
+	log.Warn("None of GOPATH entries is writable: %v, use '--gopath' to choose one", gopaths)
+	return ""
+}
+
 // setup initializes and checks common environment variables.
 func setup(ctx *cli.Context) (err error) {
 	setting.Debug = ctx.GlobalBool("debug")
-	log.NonColor = ctx.GlobalBool("noterm")
-	log.Verbose = ctx.Bool("verbose")
+	switch color := ctx.GlobalString("color"); {
+	case ctx.GlobalBool("noterm") || color == "never":
+		log.NonColor = true
+	case color == "always":
+		log.NonColor = false
+	case color == "auto" || len(color) == 0:
+		log.NonColor = !log.CanColor(log.Output)
+	default:
+		return fmt.Errorf("Invalid value of option '--color': %s", color)
+	}
+	// Debug messages are useless if they are not printed.
+	log.Verbose = ctx.Bool("verbose") || setting.Debug
+	// Only structured records should go out in JSON mode.
+	if ctx.GlobalBool("json") {
+		log.Verbose = false
+		log.Output = ioutil.Discard
+	}
+	// Quiet mode wins over verbose mode, errors are still printed.
+	if ctx.GlobalBool("quiet") {
+		log.Verbose = false
+		log.Quiet = true
+	}
 
 	log.Info("App Version: %s", ctx.App.Version)
 
@@ -45,7 +110,27 @@ func setup(ctx *cli.Context) (err error) {
 	}
 	setting.HomeDir = strings.Replace(setting.HomeDir, "\\", "/", -1)
 
-	setting.InstallRepoPath = path.Join(setting.HomeDir, ".gopm/repos")
+	// Config file only gives default values, options in command line
+	// and environment variables always have higher priority.
+	setting.ConfigFile = path.Join(setting.HomeDir, ".gopm/data/gopm.ini")
+	if err = setting.LoadConfig(); err != nil {
+		return err
+	}
+
+	// Repository path from command line has the highest priority,
+	// then the environment variable and config file.
+	setting.InstallRepoPath = ctx.GlobalString("repos")
+	if len(setting.InstallRepoPath) == 0 {
+		setting.InstallRepoPath = os.Getenv("GOPM_REPOS")
+	}
+	if len(setting.InstallRepoPath) == 0 {
+		setting.InstallRepoPath = setting.ConfigReposPath
+	}
+	if len(setting.InstallRepoPath) == 0 {
+		setting.InstallRepoPath = path.Join(setting.HomeDir, ".gopm/repos")
+	}
+	setting.InstallRepoPath = strings.Replace(
+		base.ExpandHome(setting.InstallRepoPath, setting.HomeDir), "\\", "/", -1)
 	if runtime.GOOS == "windows" {
 		setting.IsWindows = true
 	}
@@ -87,14 +172,26 @@ func setup(ctx *cli.Context) (err error) {
 			// }
 
 		} else {
-			// Get GOPATH.
-			setting.InstallGopath = base.GetGOPATHs()[0]
+			// Get GOPATH, command line has the highest priority.
+			gopaths := base.SplitGOPATH(ctx.GlobalString("gopath"))
+			if len(gopaths) == 0 {
+				gopaths = base.GetGOPATHs()
+			}
+			if len(gopaths) == 0 {
+				gopaths = base.SplitGOPATH(setting.ConfigGopath)
+			}
+			if len(gopaths) == 0 {
+				gopaths = base.SplitGOPATH(build.Default.GOPATH)
+			}
+			setting.InstallGopath = selectGopath(gopaths)
 			if base.IsDir(setting.InstallGopath) {
 				log.Info("Indicated GOPATH: %s", setting.InstallGopath)
 				setting.InstallGopath += "/src"
 				setting.HasGOPATHSetting = true
 			} else {
-				if ctx.Bool("gopath") {
+				if ctx.Bool("gopath") && len(setting.InstallGopath) == 0 {
+					return fmt.Errorf("No writable GOPATH entry available, please choose one with '--gopath' option")
+				} else if ctx.Bool("gopath") {
 					return fmt.Errorf("Local GOPATH does not exist or is not a directory: %s",
 						setting.InstallGopath)
 				} else {
@@ -106,10 +203,28 @@ func setup(ctx *cli.Context) (err error) {
 		}
 	}
 
-	setting.ConfigFile = path.Join(setting.HomeDir, ".gopm/data/gopm.ini")
-	if err = setting.LoadConfig(); err != nil {
+	// Proxy from command line has the highest priority.
+	if proxy := ctx.GlobalString("proxy"); len(proxy) > 0 {
+		setting.HttpProxy = proxy
+	}
+	if err = doc.SetProxy(setting.HttpProxy); err != nil {
 		return err
 	}
+	if mirrors := ctx.GlobalString("mirrors"); len(mirrors) > 0 {
+		setting.Mirrors = setting.ParseMirrors(mirrors)
+	}
+	// Credentials from command line override the ones in config file.
+	if auth := ctx.GlobalString("auth"); len(auth) > 0 {
+		doc.SetAuth(auth)
+	} else {
+		doc.SetAuth(setting.Authorization)
+	}
+	doc.SetInsecure(ctx.GlobalBool("insecure"))
+	doc.SetRateLimit(ctx.GlobalFloat64("ratelimit"))
+	doc.SetMaxIdleConnsPerHost(setting.MaxIdleConnsPerHost)
+	if timeout := ctx.GlobalDuration("timeout"); ctx.GlobalIsSet("timeout") && timeout > 0 {
+		setting.DownloadTimeout = timeout
+	}
 
 	setting.PkgNameListFile = path.Join(setting.HomeDir, ".gopm/data/pkgname.list")
 	if err = setting.LoadPkgNameList(); err != nil {
@@ -120,6 +235,12 @@ func setup(ctx *cli.Context) (err error) {
 	if err = setting.LoadLocalNodes(); err != nil {
 		return err
 	}
+
+	setting.RefreshMetadata = ctx.GlobalBool("refresh")
+	setting.MetadataFile = path.Join(setting.HomeDir, ".gopm/data/metadata.list")
+	if err = setting.LoadMetadata(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -141,6 +262,11 @@ func autoLink(oldPath, newPath string) error {
 }
 
 func execCmd(gopath, curPath string, args ...string) error {
+	return execCmdEnv(gopath, curPath, nil, args...)
+}
+
+// execCmdEnv is same as execCmd but with extra environment variables.
+func execCmdEnv(gopath, curPath string, env []string, args ...string) error {
 	oldGopath := os.Getenv("GOPATH")
 	log.Info("Setting GOPATH to %s", gopath)
 
@@ -165,6 +291,10 @@ func execCmd(gopath, curPath string, args ...string) error {
 
 	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Dir = curPath
+	if len(env) > 0 {
+		log.Info("Setting environment %v", env)
+		cmd.Env = append(os.Environ(), env...)
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -0,0 +1,54 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSelectGopath(t *testing.T) {
+	dir := t.TempDir()
+	first, second := path.Join(dir, "first"), path.Join(dir, "second")
+	if err := os.Mkdir(second, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	missing := path.Join(dir, "missing")
+
+	tests := []struct {
+		gopaths []string
+		expect  string
+	}{
+		{[]string{}, ""},
+		{[]string{missing}, missing},
+		{[]string{first, second}, second},
+		{[]string{second, first}, second},
+		{[]string{first, missing}, ""},
+	}
+	for _, test := range tests {
+		if gopath := selectGopath(append([]string{}, test.gopaths...)); gopath != test.expect {
+			t.Errorf("selectGopath(%v): expect %q, got %q", test.gopaths, test.expect, gopath)
+		}
+	}
+
+	// Both entries are usable, the first one is chosen.
+	if err := os.Mkdir(first, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if gopath := selectGopath([]string{first, second}); gopath != first {
+		t.Errorf("selectGopath(%v): expect %q, got %q", []string{first, second}, first, gopath)
+	}
+}
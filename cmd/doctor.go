@@ -0,0 +1,146 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
+	"github.com/gpmgo/gopm/modules/errors"
+	"github.com/gpmgo/gopm/modules/log"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+var CmdDoctor = cli.Command{
+	Name:  "doctor",
+	Usage: "diagnose environment issues",
+	Description: `Command doctor checks environment that gopm depends on
+
+gopm doctor
+
+It checks GOPATH, gopm local repository, version control tools
+and network access to gopm registry, then prints a report.
+It fails when any critical check fails.`,
+	Action: runDoctor,
+	Flags: []cli.Flag{
+		cli.BoolFlag{"verbose, v", "show process details", ""},
+	},
+}
+
+// doctorTimeout is the maximum time to wait for gopm registry to respond.
+const doctorTimeout = 10 * time.Second
+
+// checkResult represents result of a single check of doctor command.
+type checkResult struct {
+	Name       string
+	IsOK       bool
+	IsCritical bool // Command fails when a critical check fails.
+	Detail     string
+}
+
+// checkDir checks if given directory exists and is writable.
+func checkDir(name, dirPath string) *checkResult {
+	r := &checkResult{Name: name, IsCritical: true, Detail: dirPath}
+	switch {
+	case len(dirPath) == 0:
+		r.Detail = "not set"
+	case !base.IsDir(dirPath):
+		r.Detail += " (does not exist or is not a directory)"
+	case !base.IsWritableDir(dirPath):
+		r.Detail += " (not writable)"
+	default:
+		r.IsOK = true
+	}
+	return r
+}
+
+// checkVcs checks if given version control tool is available in PATH,
+// they are only needed by '--vcs' option of get command.
+func checkVcs(name string) *checkResult {
+	r := &checkResult{Name: name}
+	p, err := exec.LookPath(name)
+	if err != nil {
+		r.Detail = "not found in PATH"
+		return r
+	}
+	r.IsOK, r.Detail = true, p
+	return r
+}
+
+// checkRegistry checks if gopm registry can be accessed.
+func checkRegistry() *checkResult {
+	r := &checkResult{Name: "registry", IsCritical: true, Detail: setting.RegistryURL}
+	client := &http.Client{Transport: doc.HttpClient.Transport, Timeout: doctorTimeout}
+	resp, err := client.Head(setting.RegistryURL)
+	if err != nil {
+		r.Detail += fmt.Sprintf(" (%v)", err)
+		return r
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		r.Detail += fmt.Sprintf(" (%s)", resp.Status)
+		return r
+	}
+	r.IsOK = true
+	return r
+}
+
+func runDoctor(ctx *cli.Context) {
+	if err := setup(ctx); err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	gopath := ""
+	if setting.HasGOPATHSetting {
+		gopath = strings.TrimSuffix(setting.InstallGopath, "/src")
+	}
+	results := []*checkResult{
+		checkDir("GOPATH", gopath),
+		checkDir("repos", setting.InstallRepoPath),
+		checkVcs("git"),
+		checkVcs("hg"),
+		checkVcs("bzr"),
+		checkRegistry(),
+	}
+
+	failed := 0
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case r.IsOK:
+		case r.IsCritical:
+			status = "FAIL"
+			failed++
+		default:
+			status = "warn"
+		}
+		fmt.Printf("[%-4s] %-8s %s\n", status, r.Name, r.Detail)
+	}
+
+	if failed > 0 {
+		errors.SetError(fmt.Errorf("%d critical check(s) failed", failed))
+		return
+	}
+	if !log.Quiet {
+		fmt.Println("All critical checks passed")
+	}
+}
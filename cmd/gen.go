@@ -21,6 +21,7 @@ import (
 
 	"github.com/gpmgo/gopm/modules/base"
 	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
 	"github.com/gpmgo/gopm/modules/errors"
 	"github.com/gpmgo/gopm/modules/log"
 	"github.com/gpmgo/gopm/modules/setting"
@@ -33,11 +34,15 @@ var CmdGen = cli.Command{
 
 gopm gen
 
-Make sure you run this command in the root path of a go project.`,
+Make sure you run this command in the root path of a go project.
+
+Use '--pin, -p' to record revisions of dependencies that have been installed.`,
 	Action: runGen,
 	Flags: []cli.Flag{
 		cli.StringFlag{"tags", "", "apply build tags", ""},
 		cli.BoolFlag{"local, l", "generate local GOPATH directories", ""},
+		cli.BoolFlag{"test, t", "include imports of test files", ""},
+		cli.BoolFlag{"pin, p", "pin dependencies to revisions installed in gopm local repository", ""},
 		cli.BoolFlag{"verbose, v", "show process details", ""},
 	},
 }
@@ -65,9 +70,19 @@ func runGen(ctx *cli.Context) {
 	}
 	for _, name := range list {
 		// Check if user has specified the version.
-		if val := gf.MustValue("deps", name); len(val) == 0 {
-			gf.SetValue("deps", name, "")
+		if val := gf.MustValue("deps", name); len(val) > 0 {
+			continue
+		}
+		var val string
+		if ctx.Bool("pin") {
+			if rev := setting.LocalNodes.MustValue(name, "value"); len(rev) > 0 {
+				val = string(doc.COMMIT) + ":" + rev
+				log.Info("Pinned %s to %s", name, val)
+			} else {
+				log.Warn("No installed revision of %s, leave it unpinned", name)
+			}
 		}
+		gf.SetValue("deps", name, val)
 	}
 
 	// Check resources.
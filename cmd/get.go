@@ -15,10 +15,17 @@
 package cmd
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gpmgo/gopm/modules/base"
 	"github.com/gpmgo/gopm/modules/cli"
@@ -44,18 +51,58 @@ Can specify one or more: gopm get cli@tag:v1.2.0 github.com/Unknwon/macaron
 
 If no version specified and package exists in GOPATH,
 it will be skipped, unless user enabled '--remote, -r' option
-then all the packages go into gopm local repository.`,
+then all the packages go into gopm local repository.
+
+Use '--flat' to extract packages straight into GOPATH by plain import path,
+so they can be imported at once. Only one version of a package exists then,
+use '--remote, -r' to keep versions side by side in gopm local repository.
+
+Use '--dry-run' to show what would be fetched, dependencies of packages
+not yet downloaded are unknown so they are not listed.
+
+Use '--frozen' in CI to fetch exactly the archives recorded in gopm.lock,
+every package is extracted again and nothing new is resolved.
+
+Use '--depth' to limit how deep dependencies are fetched, counted from
+given package(s) or the ones of current project.
+
+Use '--list' to see files in archive of given package(s) before installing.
+
+Use '--asset' to install prebuilt file attached to a release instead of
+source code, only GitHub releases are supported.
+
+Packages may declare a post-install command in '[hooks] post_install'
+of their gopmfile, it is only run with '--run-hooks'.`,
 	Action: runGet,
-	Flags: []cli.Flag{
-		cli.StringFlag{"tags", "", "apply build tags", ""},
-		cli.BoolFlag{"download, d", "download given package only", ""},
-		cli.BoolFlag{"update, u", "update package(s) and dependencies if any", ""},
-		cli.BoolFlag{"local, l", "download all packages to local GOPATH", ""},
-		cli.BoolFlag{"gopath, g", "download all packages to GOPATH", ""},
-		cli.BoolFlag{"remote, r", "download all packages to gopm local repository", ""},
-		cli.BoolFlag{"verbose, v", "show process details", ""},
-		cli.BoolFlag{"save, s", "save dependency to gopmfile", ""},
-	},
+	Flags:  getFlags,
+}
+
+// getFlags are flags of command get, they are also used to build context
+// when packages are fetched by options.
+var getFlags = []cli.Flag{
+	cli.StringFlag{"tags", "", "apply build tags", ""},
+	cli.BoolFlag{"download, d", "download given package only, without installing to GOPATH", ""},
+	cli.BoolFlag{"update, u", "update package(s) and dependencies if any", ""},
+	cli.IntFlag{"depth", -1, "maximum depth of dependencies to fetch, 0 for given package(s) only, -1 for unlimited", ""},
+	cli.BoolFlag{"local, l", "download all packages to local GOPATH", ""},
+	cli.BoolFlag{"gopath, g", "download all packages to GOPATH", ""},
+	cli.BoolFlag{"remote, r", "download all packages to gopm local repository", ""},
+	cli.BoolFlag{"locked", "fetch packages strictly with versions in gopm.lock", ""},
+	cli.BoolFlag{"frozen", "fetch packages strictly with versions and checksums in gopm.lock, any difference fails", ""},
+	cli.StringFlag{"vendor", "", "install packages into given vendor directory instead of GOPATH", ""},
+	cli.BoolFlag{"flat", "extract packages into GOPATH by plain import path, without version suffix", ""},
+	cli.BoolFlag{"dry-run", "show what would be fetched without downloading anything", ""},
+	cli.BoolFlag{"list", "download archive of given package(s) and list files in it without installing", ""},
+	cli.StringFlag{"asset", "", "download release asset matching given glob pattern into bin directory instead of source", ""},
+	cli.BoolFlag{"offline", "install packages from gopm local repository only, without network", ""},
+	cli.BoolFlag{"no-cache", "delete downloaded archive after extraction to save disk", ""},
+	cli.BoolFlag{"keep", "keep downloaded archive even if NO_CACHE is set in configuration", ""},
+	cli.BoolFlag{"force", "skip free disk space check before extracting and copying packages", ""},
+	cli.BoolFlag{"run-hooks", "run post-install hooks in gopmfile of fetched packages", ""},
+	cli.StringFlag{"exclude", "", "skip files matching comma-separated glob patterns when extracting", ""},
+	cli.BoolFlag{"vcs", "use version control tools to fetch package(s) into GOPATH", ""},
+	cli.BoolFlag{"verbose, v", "show process details", ""},
+	cli.BoolFlag{"save, s", "save dependency to gopmfile", ""},
 }
 
 var (
@@ -63,16 +110,311 @@ var (
 	downloadCache = base.NewSafeMap()
 	skipCache     = base.NewSafeMap()
 	copyCache     = base.NewSafeMap()
-	downloadCount int
-	failCount     int
+	depthCache    = base.NewSafeMap()
+	downloadCount int32
+	failCount     int32
+	depthCount    int32 // Number of packages skipped by depth limit.
+)
+
+// resetGetState clears what the previous run of get has left,
+// so packages can be fetched again in the same process.
+func resetGetState() {
+	downloadCache = base.NewSafeMap()
+	skipCache = base.NewSafeMap()
+	copyCache = base.NewSafeMap()
+	depthCache = base.NewSafeMap()
+	downloadCount, failCount, depthCount = 0, 0, 0
+	lockFile, lockedFile = nil, nil
+	getResults = nil
+}
+
+// maxGetWorkers is the number of packages that can be downloaded at the same time.
+const maxGetWorkers = 4
+
+var (
+	downloadLock sync.Mutex
+	// Packages being downloaded by workers, closed when they are done.
+	downloadCalls = make(map[string]chan struct{})
+)
+
+// startDownload marks package of given version as being downloaded and returns
+// function to call when it is done. It returns nil when package has been taken
+// by other worker, after waiting for its download to finish.
+func startDownload(verStr string) func() {
+	downloadLock.Lock()
+	if !downloadCache.SetIfAbsent(verStr) {
+		downloadLock.Unlock()
+		waitDownload(verStr)
+		return nil
+	}
+	call := make(chan struct{})
+	downloadCalls[verStr] = call
+	downloadLock.Unlock()
+	return func() {
+		downloadLock.Lock()
+		delete(downloadCalls, verStr)
+		downloadLock.Unlock()
+		close(call)
+	}
+}
+
+// waitDownload blocks until package of given version is not being downloaded.
+// Only download of package itself is waited, not its dependencies, so that
+// packages importing each other never wait for one another.
+func waitDownload(verStr string) {
+	downloadLock.Lock()
+	call := downloadCalls[verStr]
+	downloadLock.Unlock()
+	if call != nil {
+		log.Debug("Waiting for package being downloaded: %s", verStr)
+		<-call
+	}
+}
+
+var (
+	// lockFile records resolved versions of packages fetched by gopmfile.
+	lockFile *goconfig.ConfigFile
+	// lockedFile is the existed lock file to fetch packages strictly with.
+	lockedFile *goconfig.ConfigFile
 )
 
+// lockNode records resolved version of given node in lock file,
+// package without any version is pinned to the revision it has been fetched.
+func lockNode(n *doc.Node) {
+	if lockFile == nil {
+		return
+	}
+	tp, val := n.Type, n.Value
+	if n.IsEmptyVal() {
+		if len(n.Revision) == 0 {
+			return
+		}
+		tp, val = doc.COMMIT, n.Revision
+	}
+	lockFile.SetValue("deps", n.RootPath, string(tp)+":"+val)
+
+	if sum := nodeChecksum(n); len(sum) > 0 {
+		lockFile.SetValue("checksums", n.RootPath, sum)
+	}
+}
+
+// nodeChecksum returns checksum of archive that given node comes from,
+// package in local repository may not be downloaded in this run.
+func nodeChecksum(n *doc.Node) string {
+	if len(n.Checksum) > 0 {
+		return n.Checksum
+	}
+	return setting.LocalNodes.MustValue(n.RootPath, "checksum"+n.ValSuffix())
+}
+
+// pinNode sets checksum recorded in lock file to given node in frozen mode,
+// so only the exact same archive can be installed.
+func pinNode(ctx *cli.Context, n *doc.Node) error {
+	if !ctx.Bool("frozen") {
+		return nil
+	}
+	sum := lockedFile.MustValue("checksums", n.RootPath)
+	if len(sum) == 0 {
+		return fmt.Errorf("checksum of package(%s) is not found in lock file", n.RootPath)
+	}
+	n.Checksum = sum
+	return nil
+}
+
+// Status of packages in get results.
+const (
+	STATUS_INSTALLED = "installed"
+	STATUS_UPDATED   = "updated"
+	STATUS_CACHED    = "cached"
+	STATUS_UNCHANGED = "unchanged"
+	STATUS_FAILED    = "failed"
+)
+
+// getResult is the record of a package printed in JSON mode or summary.
+type getResult struct {
+	Name        string         `json:"name"`
+	Status      string         `json:"status"`
+	Version     string         `json:"version,omitempty"`
+	Revision    string         `json:"revision,omitempty"`
+	DownloadURL string         `json:"download_url,omitempty"`
+	ArchivePath string         `json:"archive_path,omitempty"`
+	Mirror      string         `json:"mirror,omitempty"`
+	Bytes       int64          `json:"bytes"`
+	InstallPath string         `json:"install_path,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Attempts    []*doc.Attempt `json:"attempts,omitempty"`
+
+	node *doc.Node
+}
+
+var (
+	resultLock sync.Mutex
+	getResults []getResult
+)
+
+// printResult records result of given node for summary,
+// and prints it to stdout when JSON mode is on.
+func printResult(ctx *cli.Context, n *doc.Node, status string, err error) {
+	r := getResult{
+		Name:        n.ImportPath,
+		Status:      status,
+		Revision:    n.Revision,
+		DownloadURL: n.ArchiveURL,
+		ArchivePath: n.ArchivePath,
+		Mirror:      n.Mirror,
+		Bytes:       n.ArchiveSize,
+		Attempts:    n.Attempts,
+		node:        n,
+	}
+	if !n.IsEmptyVal() {
+		r.Version = string(n.Type) + ":" + n.Value
+	}
+	if err != nil {
+		r.Status = STATUS_FAILED
+		r.Error = err.Error()
+	} else {
+		r.InstallPath = n.InstallPath
+	}
+
+	resultLock.Lock()
+	defer resultLock.Unlock()
+	getResults = append(getResults, r)
+	if ctx.GlobalBool("json") {
+		json.NewEncoder(os.Stdout).Encode(r)
+	}
+}
+
+// printSummary prints an aligned table of all get results to stdout,
+// it does nothing in JSON or quiet mode or when there is only one result.
+func printSummary(ctx *cli.Context) {
+	if ctx.GlobalBool("json") || log.Quiet || len(getResults) < 2 {
+		return
+	}
+
+	isColor := !log.NonColor && (ctx.GlobalString("color") == "always" || log.CanColor(os.Stdout))
+	rows := make([][4]string, 0, len(getResults)+1)
+	rows = append(rows, [4]string{"PACKAGE", "VERSION", "STATUS", "SIZE"})
+	for _, r := range getResults {
+		ver := r.Version
+		if len(ver) == 0 {
+			ver = r.Revision
+		}
+		if len(ver) == 0 {
+			ver = "-"
+		}
+		size := "-"
+		if r.Bytes > 0 {
+			size = base.HumaneSize(r.Bytes)
+		}
+		rows = append(rows, [4]string{r.Name, ver, r.Status, size})
+	}
+
+	var widths [4]int
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	fmt.Println()
+	for i, row := range rows {
+		line := fmt.Sprintf("%-*s  %-*s  %-*s  %s",
+			widths[0], row[0], widths[1], row[1], widths[2], row[2], row[3])
+		if isColor && i > 0 && row[2] == STATUS_FAILED {
+			line = "\033[31m" + line + "\033[0m"
+		}
+		fmt.Println(line)
+	}
+	for _, r := range getResults {
+		if len(r.Error) > 0 {
+			fmt.Printf("%s: %s\n", r.Name, r.Error)
+		}
+	}
+}
+
+// printPlan prints what would be done for given node in dry run mode.
+func printPlan(ctx *cli.Context, n *doc.Node) {
+	status := "download"
+	if n.IsExist() && !ctx.Bool("update") {
+		status = "installed"
+	}
+	fmt.Printf("-> %s%s [%s]\n", n.ImportPath, n.VerSuffix(), status)
+	if status == "download" {
+		fmt.Printf("   url: %s\n", n.RegistryURL())
+	}
+	fmt.Printf("   path: %s\n", n.InstallPath)
+	if isInstallGopath(ctx) {
+		fmt.Printf("   gopath: %s\n", n.InstallGopath)
+	}
+}
+
+// isInstallGopath returns true if downloaded packages should be copied to GOPATH,
+// download only mode keeps them in gopm local repository.
+// Flat layout has nothing to copy because packages are extracted there.
+func isInstallGopath(ctx *cli.Context) bool {
+	return (ctx.Bool("gopath") || ctx.Bool("local") || len(ctx.String("vendor")) > 0) &&
+		!ctx.Bool("download") && !ctx.Bool("flat")
+}
+
+// revisionKey returns key of recorded revision in local nodes, packages
+// in flat layout are recorded apart from ones in gopm local repository.
+func revisionKey() string {
+	if setting.FlatLayout {
+		return "flat_value"
+	}
+	return "value"
+}
+
+// maxDepth returns maximum depth of dependencies to fetch,
+// it returns -1 for unlimited.
+func maxDepth(ctx *cli.Context) int {
+	if !ctx.IsSet("depth") {
+		return -1
+	}
+	return ctx.Int("depth")
+}
+
+// runHook runs post-install hook in gopmfile of package after it is extracted,
+// which is a shell command for generation steps like 'go generate ./...'.
+// Hooks are only run when user opts in, because they come from remote.
+func runHook(ctx *cli.Context, n *doc.Node) error {
+	if !n.IsExtracted {
+		return nil
+	}
+	gf, err := setting.LoadGopmfile(path.Join(n.InstallPath, setting.GOPMFILE))
+	if err != nil {
+		return err
+	}
+	hook := gf.MustValue("hooks", "post_install")
+	if len(hook) == 0 {
+		return nil
+	} else if !ctx.Bool("run-hooks") {
+		log.Warn("Skipped post-install hook of %s, use '--run-hooks' to run it: %s", n.RootPath, hook)
+		return nil
+	}
+
+	log.Info("Running post-install hook of %s: %s", n.RootPath, hook)
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	stdout, stderr, err := base.ExecCmdDir(n.InstallPath, shell, flag, hook)
+	if err != nil || !log.Quiet {
+		fmt.Fprint(log.Output, stdout, stderr)
+	}
+	if err != nil {
+		return fmt.Errorf("post-install hook failed: %v", err)
+	}
+	return nil
+}
+
 // downloadPackage downloads package either use version control tools or not.
 func downloadPackage(ctx *cli.Context, n *doc.Node) (*doc.Node, []string, error) {
 
 	// fmt.Println(n.VerString())
 	log.Info("Downloading package: %s", n.VerString())
-	downloadCache.Set(n.VerString())
 
 	vendor := base.GetTempDir()
 	defer os.RemoveAll(vendor)
@@ -85,8 +427,18 @@ func downloadPackage(ctx *cli.Context, n *doc.Node) (*doc.Node, []string, error)
 
 	// Check if only need to use VCS tools.
 	vcs := doc.GetVcsName(n.InstallGopath)
-	// If update, gopath and VCS tools set then use VCS tools to update the package.
-	if ctx.Bool("update") && (ctx.Bool("gopath") || ctx.Bool("local")) && len(vcs) > 0 {
+	if ctx.Bool("vcs") {
+		if len(vcs) > 0 {
+			err = n.UpdateByVcs(vcs)
+		} else {
+			err = n.CloneByVcs()
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("fail to fetch by VCS(%s): %v", n.ImportPath, err)
+		}
+		srcPath = n.InstallGopath
+	} else if ctx.Bool("update") && (ctx.Bool("gopath") || ctx.Bool("local")) && len(vcs) > 0 {
+		// If update, gopath and VCS tools set then use VCS tools to update the package.
 		if err = n.UpdateByVcs(vcs); err != nil {
 			return nil, nil, fmt.Errorf("fail to update by VCS(%s): %v", n.ImportPath, err)
 		}
@@ -94,17 +446,32 @@ func downloadPackage(ctx *cli.Context, n *doc.Node) (*doc.Node, []string, error)
 	} else {
 		if !n.IsGetDepsOnly || !n.IsExist() {
 			// Get revision value from local records.
-			n.Revision = setting.LocalNodes.MustValue(n.RootPath, "value")
-			if err = n.DownloadGopm(ctx); err != nil {
+			n.Revision = setting.LocalNodes.MustValue(n.RootPath, revisionKey())
+			if err = n.DownloadGopm(ctx); err == nil {
+				err = runHook(ctx, n)
+			}
+			if err != nil {
+				printResult(ctx, n, "", err)
 				errors.AppendError(errors.NewErrDownload(n.ImportPath + ": " + err.Error()))
-				failCount++
-				os.RemoveAll(n.InstallPath)
+				atomic.AddInt32(&failCount, 1)
+				// Old copy in GOPATH is still usable if it is not replaced yet.
+				if !setting.FlatLayout || n.IsExtracted {
+					os.RemoveAll(n.InstallPath)
+				}
 				return nil, nil, nil
 			}
 		}
 		srcPath = n.InstallPath
 	}
 
+	// Whole repository is fetched, make sure given subpackage is part of it.
+	if n.ImportPath != n.RootPath {
+		subPath := path.Join(srcPath, strings.TrimPrefix(n.ImportPath, n.RootPath))
+		if !base.IsDir(subPath) {
+			return nil, nil, fmt.Errorf("subpackage(%s) does not exist in repository(%s)", n.ImportPath, n.RootPath)
+		}
+	}
+
 	if n.IsGetDeps {
 		imports, err = getDepList(ctx, n.ImportPath, srcPath, vendor)
 		if err != nil {
@@ -122,30 +489,65 @@ func downloadPackage(ctx *cli.Context, n *doc.Node) (*doc.Node, []string, error)
 // otherwise, it only downloada package with specific commit only.
 func downloadPackages(target string, ctx *cli.Context, nodes []*doc.Node) (err error) {
 	for _, n := range nodes {
+		if doc.IsInterrupted() {
+			return fmt.Errorf("interrupted by user")
+		}
+
 		// Check if it is a valid remote path or C.
 		if n.ImportPath == "C" {
 			continue
-		} else if !base.IsValidRemotePath(n.ImportPath) {
+		} else if err := base.ValidateRemotePath(n.ImportPath); err != nil {
 			// Invalid import path.
 			if setting.LibraryMode {
 				errors.AppendError(errors.NewErrInvalidPackage(n.VerString()))
 			}
-			log.Error("Skipped invalid package: " + n.VerString())
-			failCount++
+			log.Error("Skipped invalid package(%s): %v", n.VerString(), err)
+			printResult(ctx, n, "", err)
+			atomic.AddInt32(&failCount, 1)
 			continue
 		}
+		if needDiscovery(ctx, n) {
+			discoverRoot(ctx, n)
+		}
 
 		// Valid import path.
 		if isSubpackage(n.RootPath, target) {
 			continue
 		}
 
-		// Indicates whether need to download package or update.
-		if n.IsFixed() && n.IsExist() {
+		if depth := maxDepth(ctx); depth >= 0 && n.Depth > depth {
+			if depthCache.SetIfAbsent(n.RootPath) {
+				atomic.AddInt32(&depthCount, 1)
+				log.Debug("Skipped package beyond depth %d: %s", depth, n.VerString())
+			}
+			continue
+		}
+
+		if ctx.Bool("offline") && n.Type == doc.TAG && doc.IsVersionConstraint(n.Value) {
+			return fmt.Errorf("version constraint of package(%s) cannot be resolved in offline mode", n.VerString())
+		}
+		if err := n.ResolveVersion(); err != nil {
+			log.Error("Fail to resolve version(%s): %v", n.VerString(), err)
+			printResult(ctx, n, "", err)
+			atomic.AddInt32(&failCount, 1)
+			continue
+		}
+
+		if ctx.Bool("dry-run") {
+			if downloadCache.SetIfAbsent(n.VerString()) {
+				printPlan(ctx, n)
+			}
+			continue
+		}
+
+		// Indicates whether need to download package or update,
+		// frozen mode never trusts what is in local repository.
+		if n.IsFixed() && n.IsExist() && !ctx.Bool("update") && !ctx.Bool("frozen") {
 			n.IsGetDepsOnly = true
 		}
 
 		if downloadCache.Get(n.VerString()) {
+			waitDownload(n.VerString())
 			if !skipCache.Get(n.VerString()) {
 				skipCache.Set(n.VerString())
 				log.Debug("Skipped downloaded package: %s", n.VerString())
@@ -153,7 +555,13 @@ func downloadPackages(target string, ctx *cli.Context, nodes []*doc.Node) (err e
 			continue
 		}
 
-		if !ctx.Bool("update") {
+		if ctx.Bool("vcs") {
+			// Packages fetched by VCS tools only exist in GOPATH.
+			if !ctx.Bool("update") && n.IsExistGopath() {
+				log.Debug("Skipped existed package in GOPATH: %s", n.VerString())
+				continue
+			}
+		} else if !ctx.Bool("update") && !ctx.Bool("frozen") {
 			// Check if package has been downloaded.
 			if n.IsExist() {
 				if !skipCache.Get(n.VerString()) {
@@ -162,24 +570,49 @@ func downloadPackages(target string, ctx *cli.Context, nodes []*doc.Node) (err e
 					log.Debug("Skipped installed package: %s", n.VerString())
 				}
 
+				if n.IsEmptyVal() {
+					n.Revision = setting.LocalNodes.MustValue(n.RootPath, revisionKey())
+				}
+				lockNode(n)
+				printResult(ctx, n, STATUS_CACHED, nil)
+
 				// Only copy when no version control.
-				if !copyCache.Get(n.VerString()) && (ctx.Bool("gopath") || ctx.Bool("local")) {
-					copyCache.Set(n.VerString())
+				if isInstallGopath(ctx) && copyCache.SetIfAbsent(n.VerString()) {
 					if err = n.CopyToGopath(); err != nil {
 						return err
 					}
 				}
 				continue
 			} else {
-				setting.LocalNodes.SetValue(n.RootPath, "value", "")
+				setting.LocalNodes.SetValue(n.RootPath, revisionKey(), "")
 			}
 		}
-		// Download package.
+		if ctx.Bool("offline") {
+			return fmt.Errorf("package(%s) is not in local repository, cannot get in offline mode", n.VerString())
+		}
+		// Never overwrite what user manages by version control.
+		if setting.FlatLayout && n.HasVcs() {
+			log.Warn("Package in GOPATH has version control: %s", n.RootPath)
+			continue
+		}
+
+		// Download package, other goroutine may have taken it already.
+		done := startDownload(n.VerString())
+		if done == nil {
+			continue
+		}
+		if !n.IsImportableSuffix() && !isInstallGopath(ctx) && !setting.FlatLayout {
+			log.Warn("Directory of %s is not a valid import path: %s", n.VerString(), n.InstallPath)
+			log.Warn("Use '--flat' or '--gopath, -g' to install it by plain name instead")
+		}
+		isExist := n.IsExist()
 		nod, imports, err := downloadPackage(ctx, n)
+		done()
 		if err != nil {
+			printResult(ctx, n, "", err)
 			return err
 		}
-		for _, name := range imports {
+		if len(imports) > 0 {
 			var gf *goconfig.ConfigFile
 			gfPath := path.Join(n.InstallPath, setting.GOPMFILE)
 
@@ -194,22 +627,37 @@ func downloadPackages(target string, ctx *cli.Context, nodes []*doc.Node) (err e
 			}
 
 			// Need to download dependencies.
-			// Generate temporary nodes.
+			// Generate temporary nodes, one for each import.
 			nodes := make([]*doc.Node, len(imports))
-			for i := range nodes {
-				nodes[i] = doc.NewNode(name, doc.BRANCH, "", !ctx.Bool("download"))
+			for i, name := range imports {
+				tp, val := doc.BRANCH, ""
 
-				if gf == nil {
-					continue
+				// Check if user specified the version, lock file has the highest priority.
+				var v string
+				if lockedFile != nil {
+					v = lockedFile.MustValue("deps", doc.GetRootPath(name))
+					if len(v) == 0 && ctx.Bool("frozen") {
+						return fmt.Errorf("package(%s) is not found in lock file", doc.GetRootPath(name))
+					}
+				} else if gf != nil {
+					v = gf.MustValue("deps", name)
 				}
-
-				// Check if user specified the version.
-				if v := gf.MustValue("deps", imports[i]); len(v) > 0 {
-					nodes[i].Type, nodes[i].Value, err = validPkgInfo(v)
+				if len(v) > 0 {
+					tp, val, err = validPkgInfo(v)
 					if err != nil {
 						return err
 					}
 				}
+				nodes[i] = doc.NewNode(name, tp, val, !ctx.Bool("download"))
+				nodes[i].Client = n.Client
+				if err = pinNode(ctx, nodes[i]); err != nil {
+					return err
+				}
+				// Subpackages of same repository are not one level deeper.
+				nodes[i].Depth = n.Depth + 1
+				if nodes[i].RootPath == n.RootPath {
+					nodes[i].Depth = n.Depth
+				}
 			}
 			if err = downloadPackages(target, ctx, nodes); err != nil {
 				return err
@@ -222,42 +670,119 @@ func downloadPackages(target string, ctx *cli.Context, nodes []*doc.Node) (err e
 		}
 
 		// Save record in local nodes.
-		log.Info("Got %s", n.VerString())
-		downloadCount++
+		atomic.AddInt32(&downloadCount, 1)
 
 		// Only save non-commit node.
 		if nod.IsEmptyVal() && len(nod.Revision) > 0 {
-			setting.LocalNodes.SetValue(nod.RootPath, "value", nod.Revision)
+			setting.LocalNodes.SetValue(nod.RootPath, revisionKey(), nod.Revision)
+		}
+		if nod.IsExtracted && setting.FlatLayout {
+			setting.LocalNodes.SetValue(nod.RootPath, "flat", nod.FlatVersion())
 		}
+		if nod.IsExtracted && len(nod.Checksum) > 0 {
+			setting.LocalNodes.SetValue(nod.RootPath, "checksum"+nod.ValSuffix(), nod.Checksum)
+		}
+		lockNode(nod)
+
+		// Nothing is downloaded when local copy is up-to-date.
+		status := STATUS_INSTALLED
+		if n.IsGetDepsOnly || (isExist && len(nod.ArchiveURL) == 0 && !nod.HasVcs()) {
+			status = STATUS_CACHED
+		} else if nod.IsUnchanged {
+			status = STATUS_UNCHANGED
+		} else if isExist {
+			status = STATUS_UPDATED
+		}
+		printResult(ctx, nod, status, nil)
 
 		// If update set downloadPackage will use VSC tools to download the package,
 		// else just download to local repository and copy to GOPATH.
-		if !nod.HasVcs() && !copyCache.Get(n.RootPath) && (ctx.Bool("gopath") || ctx.Bool("local")) {
-			copyCache.Set(n.RootPath)
+		if !nod.HasVcs() && isInstallGopath(ctx) && copyCache.SetIfAbsent(n.RootPath) {
 			if err = nod.CopyToGopath(); err != nil {
 				return err
 			}
 		}
+		printInstalled(ctx, nod)
 	}
 	return nil
 }
 
+// printInstalled tells user what version of package has been installed and where,
+// download only mode reports where the archive is instead.
+func printInstalled(ctx *cli.Context, n *doc.Node) {
+	ver := n.VerString()
+	if len(n.Revision) > 0 && n.Revision != n.Value {
+		ver += " (" + n.Revision + ")"
+	}
+	switch {
+	case ctx.Bool("download") && len(n.ArchivePath) > 0:
+		log.Info("Downloaded %s to: %s", ver, n.ArchivePath)
+	case ctx.Bool("download"):
+		log.Info("Downloaded %s to: %s", ver, n.InstallPath)
+	case ctx.Bool("vcs") || isInstallGopath(ctx):
+		log.Info("Installed %s to: %s", ver, n.InstallGopath)
+	default:
+		log.Info("Installed %s to: %s", ver, n.InstallPath)
+	}
+}
+
+// getPackages downloads given packages concurrently by a bounded number of workers,
+// errors are collected and printed after all of them are done.
 func getPackages(target string, ctx *cli.Context, nodes []*doc.Node) error {
-	if err := downloadPackages(target, ctx, nodes); err != nil {
-		return err
+	var (
+		wg    sync.WaitGroup
+		lock  sync.Mutex
+		errs  []error
+		queue = make(chan *doc.Node)
+	)
+	numWorkers := maxGetWorkers
+	if len(nodes) < numWorkers {
+		numWorkers = len(nodes)
+	}
+	// Progress lines of downloads at the same time overwrite each other.
+	doc.NoProgress = numWorkers > 1
+	defer func() { doc.NoProgress = false }()
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				if err := downloadPackages(target, ctx, []*doc.Node{n}); err != nil {
+					lock.Lock()
+					errs = append(errs, fmt.Errorf("%s: %v", n.ImportPath, err))
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, n := range nodes {
+		queue <- n
 	}
+	close(queue)
+	wg.Wait()
+
 	if err := setting.SaveLocalNodes(); err != nil {
 		return err
 	}
 
+	for _, err := range errs {
+		log.Error("%v", err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("fail to get %d package(s)", len(errs))
+	}
+
 	log.Info("%d package(s) downloaded, %d failed", downloadCount, failCount)
+	if depthCount > 0 {
+		log.Info("%d package(s) skipped by depth limit: %d", depthCount, maxDepth(ctx))
+	}
 	if ctx.GlobalBool("strict") && failCount > 0 && !setting.LibraryMode {
 		return fmt.Errorf("fail to download some packages")
 	}
 	return nil
 }
 
-func getByGopmfile(ctx *cli.Context) error {
+func getByGopmfile(ctx *cli.Context, client *http.Client) error {
 	// Make sure gopmfile exists and up-to-date.
 	gf, target, err := parseGopmfile(setting.GOPMFILE)
 	if err != nil {
@@ -269,25 +794,100 @@ func getByGopmfile(ctx *cli.Context) error {
 		return err
 	}
 
+	// Packages listed in gopmfile are always fetched,
+	// even they are not imported by any source file.
+	for _, name := range gf.GetKeyList("deps") {
+		if !base.IsSliceContainsStr(imports, name) {
+			imports = append(imports, name)
+		}
+	}
+
+	lockPath := path.Join(setting.WorkDir, setting.GOPMLOCK)
+	if ctx.Bool("locked") || ctx.Bool("frozen") {
+		if !base.IsFile(lockPath) {
+			return fmt.Errorf("lock file does not exist: %s", lockPath)
+		}
+		if lockedFile, err = setting.LoadGopmfile(lockPath); err != nil {
+			return err
+		}
+	}
+
 	// Check if dependency has version.
 	nodes := make([]*doc.Node, 0, len(imports))
 	for _, name := range imports {
 		name = doc.GetRootPath(name)
 		n := doc.NewNode(name, doc.BRANCH, "", !ctx.Bool("download"))
 
-		// Check if user specified the version.
-		if v := gf.MustValue("deps", name); len(v) > 0 {
-			n.Type, n.Value, err = validPkgInfo(v)
-			n = doc.NewNode(name, n.Type, n.Value, !ctx.Bool("download"))
+		// Check if user specified the version, lock file has the highest priority.
+		v := gf.MustValue("deps", name)
+		if lockedFile != nil {
+			if v = lockedFile.MustValue("deps", name); len(v) == 0 {
+				return fmt.Errorf("package(%s) is not found in lock file", name)
+			}
+		}
+		if len(v) > 0 {
+			tp, val, err := validPkgInfo(v)
+			if err != nil {
+				return fmt.Errorf("fail to validate package(%s): %v", name, err)
+			}
+			n = doc.NewNode(name, tp, val, !ctx.Bool("download"))
+		}
+		n.Client = client
+		if err = pinNode(ctx, n); err != nil {
+			return err
 		}
 		nodes = append(nodes, n)
 	}
 
-	return getPackages(target, ctx, nodes)
+	if lockFile, err = goconfig.LoadFromData([]byte("")); err != nil {
+		return err
+	}
+	if err = getPackages(target, ctx, nodes); err != nil {
+		return err
+	} else if ctx.Bool("dry-run") || ctx.Bool("frozen") {
+		// Lock file is the source of truth in frozen mode.
+		return nil
+	}
+	return setting.SaveGopmfile(lockFile, lockPath)
+}
+
+// discoverRoot finds real repository of vanity import path by its go-import
+// meta tag, host rules are used when there is no such tag.
+func discoverRoot(ctx *cli.Context, n *doc.Node) {
+	if ctx.Bool("offline") {
+		return
+	}
+	if err := n.DiscoverRoot(); err != nil {
+		if setting.Debug {
+			log.Debug("No go-import meta tag(%s): %v", n.ImportPath, err)
+		}
+		return
+	}
+	if len(n.RepoURL) > 0 && setting.Debug {
+		log.Debug("Found repository of %s: %s %s", n.ImportPath, n.Vcs, n.RepoURL)
+	}
 }
 
-func getByPaths(ctx *cli.Context) error {
+// needDiscovery returns false if package has been downloaded or is installed
+// and will not be downloaded again, so its host is not asked for meta tag.
+func needDiscovery(ctx *cli.Context, n *doc.Node) bool {
+	switch {
+	case downloadCache.Get(n.VerString()):
+		return false
+	case ctx.Bool("update"), ctx.Bool("frozen"):
+		return true
+	case ctx.Bool("vcs"):
+		return !n.IsExistGopath()
+	}
+	return !n.IsExist()
+}
+
+// parsePaths returns nodes of packages given in command line,
+// which are fetched by given HTTP client, nil for default one.
+func parsePaths(ctx *cli.Context, client *http.Client) ([]*doc.Node, error) {
 	nodes := make([]*doc.Node, 0, len(ctx.Args()))
+	// Same package may be given more than once.
+	seen := make(map[string]bool)
 	for _, info := range ctx.Args() {
 		pkgPath := info
 		n := doc.NewNode(pkgPath, doc.BRANCH, "", !ctx.Bool("download"))
@@ -296,7 +896,7 @@ func getByPaths(ctx *cli.Context) error {
 			pkgPath = info[:i]
 			tp, val, err := validPkgInfo(info[i+1:])
 			if err != nil {
-				return err
+				return nil, err
 			}
 			n = doc.NewNode(pkgPath, tp, val, !ctx.Bool("download"))
 		}
@@ -305,22 +905,153 @@ func getByPaths(ctx *cli.Context) error {
 		if !strings.Contains(pkgPath, "/") {
 			tmpPath, err := setting.GetPkgFullPath(pkgPath)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			if tmpPath != pkgPath {
 				n = doc.NewNode(tmpPath, n.Type, n.Value, n.IsGetDeps)
 			}
 		}
+		if err := base.ValidateRemotePath(n.ImportPath); err != nil {
+			return nil, fmt.Errorf("invalid package(%s): %v", n.ImportPath, err)
+		}
+		n.Client = client
+		if needDiscovery(ctx, n) {
+			discoverRoot(ctx, n)
+		}
+		if seen[n.VerString()] {
+			log.Debug("Skipped duplicated package: %s", n.VerString())
+			continue
+		}
+		seen[n.VerString()] = true
 		nodes = append(nodes, n)
 	}
+	return nodes, nil
+}
+
+func getByPaths(ctx *cli.Context, client *http.Client) error {
+	nodes, err := parsePaths(ctx, client)
+	if err != nil {
+		return err
+	}
 	return getPackages(".", ctx, nodes)
 }
 
-func runGet(ctx *cli.Context) {
+// listByPaths prints files in archives of given packages,
+// archives are downloaded but nothing is installed.
+func listByPaths(ctx *cli.Context, client *http.Client) error {
+	nodes, err := parsePaths(ctx, client)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if err = n.ResolveVersion(); err != nil {
+			return fmt.Errorf("fail to resolve version(%s): %v", n.VerString(), err)
+		}
+		entries, err := n.ListArchive(ctx)
+		if err != nil {
+			return fmt.Errorf("fail to list archive(%s): %v", n.VerString(), err)
+		}
+
+		var total int64
+		fmt.Printf("%s:\n", n.VerString())
+		for _, e := range entries {
+			fmt.Printf("%10s  %s\n", base.HumaneSize(e.Size), e.Name)
+			total += e.Size
+		}
+		fmt.Printf("%d files, %s\n", len(entries), base.HumaneSize(total))
+	}
+	return nil
+}
+
+// getAssets downloads release assets of given packages into bin directory
+// of GOPATH, or the one in work directory when there is no GOPATH.
+func getAssets(ctx *cli.Context, client *http.Client) error {
+	nodes, err := parsePaths(ctx, client)
+	if err != nil {
+		return err
+	}
+	binDir := path.Join(setting.WorkDir, "bin")
+	if setting.HasGOPATHSetting {
+		binDir = path.Join(path.Dir(setting.InstallGopath), "bin")
+	}
+	for _, n := range nodes {
+		if err = n.ResolveVersion(); err != nil {
+			return fmt.Errorf("fail to resolve version(%s): %v", n.VerString(), err)
+		}
+		asset, err := n.FindReleaseAsset(ctx.String("asset"))
+		if err != nil {
+			return err
+		}
+		binPath, err := n.DownloadAsset(asset, binDir)
+		if err != nil {
+			return fmt.Errorf("fail to download asset(%s): %v", asset.Name, err)
+		}
+		log.Info("Installed asset of %s to: %s", n.VerString(), binPath)
+	}
+	return nil
+}
+
+// GetOptions represents options of getting packages.
+type GetOptions struct {
+	Update       bool         // Update package and dependencies if any.
+	DownloadOnly bool         // Download package only, without installing to GOPATH.
+	Gopath       string       // GOPATH to install package into, empty for not installing.
+	Client       *http.Client // HTTP client to use, nil for default one.
+
+	// Context of command line, all options but client are taken from it when set.
+	ctx *cli.Context
+}
+
+// newGetContext returns context of command get with given packages and options,
+// other options have their default values.
+func newGetContext(paths []string, opts GetOptions) (*cli.Context, error) {
+	set := flag.NewFlagSet("get", flag.ContinueOnError)
+	for _, f := range getFlags {
+		f.Apply(set)
+	}
+	globalSet := flag.NewFlagSet("gopm", flag.ContinueOnError)
+	for _, f := range GlobalFlags {
+		f.Apply(globalSet)
+	}
+
+	// Packages are never taken as flags even they start with '-'.
+	if err := set.Parse(append([]string{"--"}, paths...)); err != nil {
+		return nil, err
+	}
+	if opts.Update {
+		set.Set("update", "true")
+	}
+	if opts.DownloadOnly {
+		set.Set("download", "true")
+	}
+	if len(opts.Gopath) > 0 {
+		globalSet.Set("gopath", opts.Gopath)
+		if !opts.DownloadOnly {
+			set.Set("gopath", "true")
+		}
+	}
+
+	app := cli.NewApp()
+	app.Name = "gopm"
+	return cli.NewContext(app, set, globalSet), nil
+}
+
+// Get fetches given packages as command get does, or packages in gopmfile
+// when none is given, and returns nodes of packages that have been processed,
+// including failed ones. Every call starts over with fresh state,
+// but calls must not be concurrent.
+func Get(paths []string, opts GetOptions) ([]*doc.Node, error) {
+	ctx := opts.ctx
+	if ctx == nil {
+		var err error
+		if ctx, err = newGetContext(paths, opts); err != nil {
+			return nil, err
+		}
+	}
 	if err := setup(ctx); err != nil {
-		errors.SetError(err)
-		return
+		return nil, err
 	}
+	resetGetState()
 
 	// Check option conflicts.
 	hasConflict := false
@@ -336,32 +1067,118 @@ func runGet(ctx *cli.Context) {
 		hasConflict = true
 		names = "'--gopath, -g' and '--remote, -r'"
 	}
+	if !hasConflict {
+		switch {
+		case ctx.Bool("vcs") && ctx.Bool("remote"):
+			hasConflict = true
+			names = "'--vcs' and '--remote, -r'"
+		case ctx.Bool("offline") && ctx.Bool("update"):
+			hasConflict = true
+			names = "'--offline' and '--update, -u'"
+		case ctx.Bool("frozen") && (ctx.Bool("update") || ctx.Bool("offline") || ctx.Bool("vcs")):
+			hasConflict = true
+			names = "'--frozen' and '--update, -u', '--offline' or '--vcs'"
+		case len(ctx.String("asset")) > 0 && (ctx.Bool("vcs") || ctx.Bool("dry-run") || ctx.Bool("list")):
+			hasConflict = true
+			names = "'--asset' and '--vcs', '--dry-run' or '--list'"
+		case ctx.Bool("list") && (ctx.Bool("vcs") || ctx.Bool("dry-run")):
+			hasConflict = true
+			names = "'--list' and '--vcs' or '--dry-run'"
+		case ctx.Bool("no-cache") && ctx.Bool("keep"):
+			hasConflict = true
+			names = "'--no-cache' and '--keep'"
+		case ctx.Bool("offline") && ctx.Bool("vcs"):
+			hasConflict = true
+			names = "'--offline' and '--vcs'"
+		case len(ctx.String("vendor")) > 0 && (ctx.Bool("gopath") || ctx.Bool("local") || ctx.Bool("remote")):
+			hasConflict = true
+			names = "'--vendor' and '--gopath, -g', '--local, -l' or '--remote, -r'"
+		case ctx.Bool("flat") && (ctx.Bool("remote") || ctx.Bool("download") || ctx.Bool("vcs")):
+			hasConflict = true
+			names = "'--flat' and '--remote, -r', '--download, -d' or '--vcs'"
+		}
+	}
 	if hasConflict {
-		errors.SetError(fmt.Errorf("Command options have conflicts: %s", names))
-		return
+		return nil, fmt.Errorf("Command options have conflicts: %s", names)
+	}
+
+	// Vendor directory is version-flat, which is same as GOPATH.
+	if vendor := ctx.String("vendor"); len(vendor) > 0 {
+		vendor, err := filepath.Abs(vendor)
+		if err != nil {
+			return nil, fmt.Errorf("Fail to get absolute path of vendor directory: %v", err)
+		}
+		os.MkdirAll(vendor, os.ModePerm)
+		setting.InstallGopath = filepath.ToSlash(vendor)
+		setting.HasGOPATHSetting = true
+	}
+
+	// Fail before any download when packages have nowhere to go.
+	if !setting.HasGOPATHSetting {
+		switch {
+		case ctx.Bool("vcs"):
+			return nil, fmt.Errorf("Option '--vcs' requires a valid GOPATH setting")
+		case isInstallGopath(ctx) || ctx.Bool("flat"):
+			return nil, fmt.Errorf("No GOPATH setting available, please set GOPATH environment variable or use '--gopath' option")
+		}
+	}
+	setting.FlatLayout = ctx.Bool("flat")
+
+	excludes, err := doc.ParseExcludes(ctx.String("exclude"))
+	if err != nil {
+		return nil, err
+	}
+	setting.Excludes = excludes
+
+	// Command line options take precedence over configuration.
+	if ctx.Bool("no-cache") {
+		setting.NoCache = true
+	} else if ctx.Bool("keep") {
+		setting.NoCache = false
+	}
+	setting.SkipDiskCheck = ctx.Bool("force")
+
+	// Updating always asks remote for latest metadata.
+	if ctx.Bool("update") {
+		setting.RefreshMetadata = true
 	}
 
-	var err error
 	// Check number of arguments to decide which function to call.
 	if len(ctx.Args()) == 0 {
 		if ctx.Bool("download") {
-			errors.SetError(fmt.Errorf("Not enough arguments for option: '--download, -d'"))
-			return
+			return nil, fmt.Errorf("Not enough arguments for option: '--download, -d'")
+		} else if ctx.Bool("list") {
+			return nil, fmt.Errorf("Not enough arguments for option: '--list'")
+		} else if len(ctx.String("asset")) > 0 {
+			return nil, fmt.Errorf("Not enough arguments for option: '--asset'")
 		}
-		err = getByGopmfile(ctx)
+		err = getByGopmfile(ctx, opts.Client)
 	} else {
-		err = getByPaths(ctx)
+		if ctx.Bool("locked") {
+			return nil, fmt.Errorf("Option '--locked' cannot be used with package arguments")
+		} else if ctx.Bool("frozen") {
+			return nil, fmt.Errorf("Option '--frozen' cannot be used with package arguments")
+		} else if ctx.Bool("list") {
+			return nil, listByPaths(ctx, opts.Client)
+		} else if len(ctx.String("asset")) > 0 {
+			return nil, getAssets(ctx, opts.Client)
+		}
+		err = getByPaths(ctx, opts.Client)
+	}
+	printSummary(ctx)
+	nodes := make([]*doc.Node, len(getResults))
+	for i := range getResults {
+		nodes[i] = getResults[i].node
+		nodes[i].Checksum = nodeChecksum(nodes[i])
 	}
 	if err != nil {
-		errors.SetError(err)
-		return
+		return nodes, err
 	}
 
 	if len(ctx.Args()) > 0 && ctx.Bool("save") {
 		gf, _, err := parseGopmfile(setting.GOPMFILE)
 		if err != nil {
-			errors.SetError(err)
-			return
+			return nil, err
 		}
 
 		for _, info := range ctx.Args() {
@@ -373,4 +1190,16 @@ func runGet(ctx *cli.Context) {
 		}
 		setting.SaveGopmfile(gf, setting.GOPMFILE)
 	}
+	return nodes, nil
+}
+
+func runGet(ctx *cli.Context) {
+	opts := GetOptions{
+		Update:       ctx.Bool("update"),
+		DownloadOnly: ctx.Bool("download"),
+		ctx:          ctx,
+	}
+	if _, err := Get(ctx.Args(), opts); err != nil {
+		errors.SetError(err)
+	}
 }
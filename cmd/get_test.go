@@ -0,0 +1,76 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/log"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+func init() {
+	log.Output = ioutil.Discard
+}
+
+// runTestCommand runs given command with arguments the way gopm does.
+func runTestCommand(c cli.Command, args ...string) error {
+	app := cli.NewApp()
+	app.Name = "gopm"
+	app.Commands = []cli.Command{c}
+	app.Flags = append(app.Flags, cli.StringFlag{"gopath", "", "", ""})
+	return app.Run(append([]string{"gopm", c.Name}, args...))
+}
+
+// runTestGet runs get command with given arguments and returns error of Get.
+func runTestGet(args ...string) (err error) {
+	c := CmdGet
+	c.Action = func(ctx *cli.Context) {
+		_, err = Get(ctx.Args(), GetOptions{ctx: ctx})
+	}
+	if runErr := runTestCommand(c, args...); runErr != nil {
+		return runErr
+	}
+	return err
+}
+
+func TestGetNoGOPATH(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GOPATH", filepath.Join(home, "nonexistent"))
+
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-l", "github.com/Unknwon/com"}, "No GOPATH setting available"},
+		{[]string{"--flat", "github.com/Unknwon/com"}, "No GOPATH setting available"},
+		{[]string{"--vcs", "github.com/Unknwon/com"}, "Option '--vcs' requires a valid GOPATH setting"},
+		{[]string{"-g", "github.com/Unknwon/com"}, "Local GOPATH does not exist or is not a directory"},
+	}
+	for _, test := range tests {
+		setting.HasGOPATHSetting = false
+		err := runTestGet(test.args...)
+		if err == nil {
+			t.Errorf("%v: expect error %q, got nil", test.args, test.err)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: expect error %q, got %q", test.args, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
+	"github.com/gpmgo/gopm/modules/errors"
+	"github.com/gpmgo/gopm/modules/goconfig"
+	"github.com/gpmgo/gopm/modules/log"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+var CmdGraph = cli.Command{
+	Name:  "graph",
+	Usage: "print dependency graph of package(s) or current project",
+	Description: `Command graph prints dependency graph in DOT format
+
+gopm graph
+gopm graph <import path>|<package name>...
+
+Graph of current project is printed when no package is given.
+Packages that are not in gopm local repository are downloaded into it
+to find their dependencies, but nothing is installed to GOPATH.
+Dependencies that form a cycle are marked as cycle.
+
+Output can be piped into graphviz, e.g. 'gopm graph | dot -Tsvg > deps.svg',
+or use '--format=text' to print it as an indented tree.`,
+	Action: runGraph,
+	Flags: []cli.Flag{
+		cli.StringFlag{"format, f", "dot", "output format: dot or text", ""},
+		cli.StringFlag{"tags", "", "apply build tags", ""},
+		cli.BoolFlag{"test, t", "include test imports", ""},
+		cli.BoolFlag{"verbose, v", "show process details", ""},
+	},
+}
+
+// graphNode represents a package in dependency graph.
+type graphNode struct {
+	Name     string // Root path with version suffix.
+	Deps     []*graphNode
+	IsFailed bool // True if package or its imports cannot be fetched.
+}
+
+// depGraph resolves dependencies recursively, every package is resolved once.
+type depGraph struct {
+	ctx    *cli.Context
+	nodes  map[string]*graphNode
+	stack  map[string]bool    // Packages being resolved in current path.
+	cycles map[[2]string]bool // Edges that close a cycle.
+}
+
+func newDepGraph(ctx *cli.Context) *depGraph {
+	return &depGraph{
+		ctx:    ctx,
+		nodes:  make(map[string]*graphNode),
+		stack:  make(map[string]bool),
+		cycles: make(map[[2]string]bool),
+	}
+}
+
+func graphName(n *doc.Node) string {
+	return n.RootPath + n.VerSuffix()
+}
+
+// depNodes returns nodes of imports, versions are taken from gopmfile if any.
+func (g *depGraph) depNodes(gf *goconfig.ConfigFile, imports []string) ([]*doc.Node, error) {
+	nodes := make([]*doc.Node, 0, len(imports))
+	for _, name := range imports {
+		tp, val := doc.BRANCH, ""
+		if gf != nil {
+			if v := gf.MustValue("deps", name); len(v) > 0 {
+				var err error
+				if tp, val, err = validPkgInfo(v); err != nil {
+					return nil, err
+				}
+			}
+		}
+		n := doc.NewNode(name, tp, val, true)
+		discoverRoot(g.ctx, n)
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// fetch makes sure package is in gopm local repository, and returns nodes
+// of its dependencies, or nil if package cannot be downloaded.
+func (g *depGraph) fetch(n *doc.Node) ([]*doc.Node, error) {
+	if err := n.ResolveVersion(); err != nil {
+		return nil, fmt.Errorf("fail to resolve version(%s): %v", n.VerString(), err)
+	}
+	n.IsGetDepsOnly = n.IsExist()
+	nod, imports, err := downloadPackage(g.ctx, n)
+	if err != nil {
+		return nil, err
+	} else if nod == nil {
+		// Error has been reported by downloadPackage.
+		return nil, nil
+	}
+
+	var gf *goconfig.ConfigFile
+	if gfPath := path.Join(n.InstallPath, setting.GOPMFILE); base.IsFile(gfPath) {
+		if gf, _, err = parseGopmfile(gfPath); err != nil {
+			return nil, fmt.Errorf("fail to parse gopmfile(%s): %v", gfPath, err)
+		}
+	}
+	return g.depNodes(gf, imports)
+}
+
+// resolve adds package and its dependencies to graph, it only returns error
+// when user interrupts, other errors are reported and package is marked failed.
+func (g *depGraph) resolve(n *doc.Node) (*graphNode, error) {
+	name := graphName(n)
+	if gn, ok := g.nodes[name]; ok {
+		return gn, nil
+	}
+	if doc.IsInterrupted() {
+		return nil, fmt.Errorf("interrupted by user")
+	}
+
+	gn := &graphNode{Name: name}
+	g.nodes[name] = gn
+	deps, err := g.fetch(n)
+	if err != nil {
+		log.Error("%v", err)
+		errors.AppendError(err)
+		gn.IsFailed = true
+		return gn, nil
+	} else if deps == nil {
+		gn.IsFailed = true
+		return gn, nil
+	}
+	return gn, g.addDeps(gn, deps)
+}
+
+// addDeps resolves dependencies of given graph node.
+func (g *depGraph) addDeps(gn *graphNode, deps []*doc.Node) error {
+	g.stack[gn.Name] = true
+	defer delete(g.stack, gn.Name)
+
+	for _, n := range deps {
+		name := graphName(n)
+		if name == gn.Name {
+			continue
+		}
+		// Package is still being resolved, so this edge closes a cycle.
+		if g.stack[name] {
+			g.cycles[[2]string{gn.Name, name}] = true
+			gn.Deps = append(gn.Deps, g.nodes[name])
+			continue
+		}
+		dep, err := g.resolve(n)
+		if err != nil {
+			return err
+		}
+		gn.Deps = append(gn.Deps, dep)
+	}
+	return nil
+}
+
+// printDot prints graph in DOT format, edges of cycles are colored red.
+func (g *depGraph) printDot(roots []*graphNode) {
+	fmt.Println("digraph gopm {")
+	seen := make(map[string]bool)
+	var walk func(gn *graphNode)
+	walk = func(gn *graphNode) {
+		if seen[gn.Name] {
+			return
+		}
+		seen[gn.Name] = true
+		switch {
+		case gn.IsFailed:
+			fmt.Printf("\t%s [color=red, label=%s];\n", strconv.Quote(gn.Name), strconv.Quote(gn.Name+" (failed)"))
+		case len(gn.Deps) == 0:
+			fmt.Printf("\t%s;\n", strconv.Quote(gn.Name))
+		}
+		for _, dep := range gn.Deps {
+			attrs := ""
+			if g.cycles[[2]string{gn.Name, dep.Name}] {
+				attrs = ` [color=red, label="cycle"]`
+			}
+			fmt.Printf("\t%s -> %s%s;\n", strconv.Quote(gn.Name), strconv.Quote(dep.Name), attrs)
+		}
+		for _, dep := range gn.Deps {
+			walk(dep)
+		}
+	}
+	for _, gn := range roots {
+		walk(gn)
+	}
+	fmt.Println("}")
+}
+
+// printText prints graph as an indented tree, dependencies of a package
+// are only printed at the first time it appears.
+func (g *depGraph) printText(roots []*graphNode) {
+	seen := make(map[string]bool)
+	var walk func(gn *graphNode, parent string, depth int)
+	walk = func(gn *graphNode, parent string, depth int) {
+		line := strings.Repeat("   ", depth)
+		if depth > 0 {
+			line = strings.Repeat("   ", depth-1) + "-> "
+		}
+		line += gn.Name
+		switch {
+		case g.cycles[[2]string{parent, gn.Name}]:
+			fmt.Println(line + " (cycle)")
+			return
+		case gn.IsFailed:
+			fmt.Println(line + " (failed)")
+			return
+		case seen[gn.Name] && len(gn.Deps) > 0:
+			fmt.Println(line + " (*)")
+			return
+		}
+		fmt.Println(line)
+		seen[gn.Name] = true
+		for _, dep := range gn.Deps {
+			walk(dep, gn.Name, depth+1)
+		}
+	}
+	for _, gn := range roots {
+		walk(gn, "", 0)
+	}
+}
+
+func runGraph(ctx *cli.Context) {
+	if err := setup(ctx); err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	format := ctx.String("format")
+	if format != "dot" && format != "text" {
+		errors.SetError(fmt.Errorf("Invalid value of option '--format': %s", format))
+		return
+	}
+
+	g := newDepGraph(ctx)
+	var roots []*graphNode
+	if len(ctx.Args()) == 0 {
+		// Graph of current project.
+		gf, target, err := parseGopmfile(setting.DefaultGopmfile)
+		if err != nil {
+			errors.SetError(err)
+			return
+		}
+		imports, err := getDepList(ctx, target, setting.WorkDir, setting.DefaultVendor)
+		if err != nil {
+			errors.SetError(err)
+			return
+		}
+		deps, err := g.depNodes(gf, imports)
+		if err != nil {
+			errors.SetError(err)
+			return
+		}
+		root := &graphNode{Name: doc.GetRootPath(target)}
+		g.nodes[root.Name] = root
+		if err = g.addDeps(root, deps); err != nil {
+			errors.SetError(err)
+			return
+		}
+		roots = append(roots, root)
+	} else {
+		nodes, err := parsePaths(ctx, nil)
+		if err != nil {
+			errors.SetError(err)
+			return
+		}
+		for _, n := range nodes {
+			gn, err := g.resolve(n)
+			if err != nil {
+				errors.SetError(err)
+				return
+			}
+			roots = append(roots, gn)
+		}
+	}
+
+	if format == "text" {
+		g.printText(roots)
+		return
+	}
+	g.printDot(roots)
+}
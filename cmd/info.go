@@ -0,0 +1,150 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
+	"github.com/gpmgo/gopm/modules/errors"
+	"github.com/gpmgo/gopm/modules/log"
+)
+
+var CmdInfo = cli.Command{
+	Name:  "info",
+	Usage: "show information of package(s) without downloading",
+	Description: `Command info shows information of package(s)
+
+gopm info <import path>|<package name>
+
+It shows available versions, latest revision and size of archive
+from gopm registry. Number of dependencies is only known when
+package exists in local repository.
+Use global option '--json' to print information in JSON format.`,
+	Action: runInfo,
+	Flags: []cli.Flag{
+		cli.BoolFlag{"verbose, v", "show process details", ""},
+	},
+}
+
+// infoResult represents information of a package.
+type infoResult struct {
+	ImportPath   string   `json:"import_path"`
+	RepoURL      string   `json:"repo_url"`
+	Revision     string   `json:"revision,omitempty"`
+	Size         int64    `json:"size,omitempty"`
+	Checksum     string   `json:"checksum,omitempty"`
+	Versions     []string `json:"versions"`
+	LocalPath    string   `json:"local_path,omitempty"`
+	Dependencies int      `json:"dependencies"` // -1 for unknown.
+}
+
+// getInfo collects information of given package, what cannot be fetched
+// is left empty with a warning.
+func getInfo(ctx *cli.Context, n *doc.Node) *infoResult {
+	r := &infoResult{
+		ImportPath:   n.ImportPath,
+		RepoURL:      "https://" + n.RootPath,
+		Versions:     []string{},
+		Dependencies: -1,
+	}
+	if len(n.RepoURL) > 0 {
+		r.RepoURL = n.RepoURL
+	}
+
+	if apiResp, err := n.LatestRevision(); err != nil {
+		log.Warn("Fail to get revision(%s): %v", n.RootPath, err)
+	} else {
+		r.Revision, r.Size, r.Checksum = apiResp.Sha, apiResp.Size, apiResp.Checksum
+	}
+
+	if tags, err := doc.ListTags(n.RootPath); err != nil {
+		log.Warn("Fail to list versions(%s): %v", n.RootPath, err)
+	} else {
+		r.Versions = tags
+	}
+
+	if n.IsExist() {
+		r.LocalPath = n.InstallPath
+		vendor := base.GetTempDir()
+		defer os.RemoveAll(vendor)
+		if imports, err := getDepList(ctx, n.ImportPath, n.InstallPath, vendor); err != nil {
+			log.Warn("Fail to list imports(%s): %v", n.ImportPath, err)
+		} else {
+			r.Dependencies = len(imports)
+		}
+	}
+	return r
+}
+
+// printInfo prints information of package in human readable form.
+func printInfo(r *infoResult) {
+	fmt.Printf("Package:      %s\n", r.ImportPath)
+	fmt.Printf("Repository:   %s\n", r.RepoURL)
+	if len(r.Revision) > 0 {
+		fmt.Printf("Revision:     %s\n", r.Revision)
+	}
+	if r.Size > 0 {
+		fmt.Printf("Size:         %s\n", base.HumaneSize(r.Size))
+	}
+	if len(r.Checksum) > 0 {
+		fmt.Printf("Checksum:     %s\n", r.Checksum)
+	}
+	fmt.Printf("Versions:     %s\n", strings.Join(r.Versions, " "))
+	if len(r.LocalPath) > 0 {
+		fmt.Printf("Local:        %s\n", r.LocalPath)
+	} else {
+		fmt.Printf("Local:        not downloaded\n")
+	}
+	if r.Dependencies >= 0 {
+		fmt.Printf("Dependencies: %d\n", r.Dependencies)
+	} else {
+		fmt.Printf("Dependencies: unknown\n")
+	}
+}
+
+func runInfo(ctx *cli.Context) {
+	if err := setup(ctx); err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	if len(ctx.Args()) == 0 {
+		errors.SetError(fmt.Errorf("Not enough arguments, please give at least one package"))
+		return
+	}
+	nodes, err := parsePaths(ctx, nil)
+	if err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	for i, n := range nodes {
+		r := getInfo(ctx, n)
+		if ctx.GlobalBool("json") {
+			json.NewEncoder(os.Stdout).Encode(r)
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		printInfo(r)
+	}
+}
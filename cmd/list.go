@@ -16,7 +16,10 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -35,12 +38,15 @@ var CmdList = cli.Command{
 	Description: `Command list lists all dependencies of current Go project
 
 gopm list
+gopm list -i
 
-Make sure you run this command in the root path of a go project.`,
+Make sure you run this command in the root path of a go project,
+or use '--installed, -i' to list packages in gopm local repository.`,
 	Action: runList,
 	Flags: []cli.Flag{
 		cli.StringFlag{"tags", "", "apply build tags", ""},
 		cli.BoolFlag{"test, t", "show test imports", ""},
+		cli.BoolFlag{"installed, i", "list packages in gopm local repository", ""},
 		cli.BoolFlag{"verbose, v", "show process details", ""},
 	},
 }
@@ -87,12 +93,94 @@ func getDepList(ctx *cli.Context, target, pkgPath, vendor string) ([]string, err
 	return list, nil
 }
 
+// isRepoRoot returns true if given directory is the root of a package
+// in gopm local repository.
+func isRepoRoot(dirPath, relPath string) bool {
+	infos := strings.Split(relPath, "/")
+	if strings.HasPrefix(relPath, "launchpad.net/~") {
+		return len(infos) == 4
+	}
+	for prefix, num := range setting.RootPathPairs {
+		if strings.HasPrefix(relPath, prefix) {
+			return len(infos) == num
+		}
+	}
+
+	// For unknown hosts, the first directory that contains files is the root.
+	fis, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return false
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// getInstalledList returns list of packages in gopm local repository,
+// in format of root path with version suffix and nature order.
+func getInstalledList() ([]string, error) {
+	list := make([]string, 0, 10)
+	err := filepath.Walk(setting.InstallRepoPath, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if !fi.IsDir() || p == setting.InstallRepoPath {
+			return nil
+		} else if strings.HasPrefix(fi.Name(), ".") {
+			// Lock files of packages are kept in hidden directory.
+			return filepath.SkipDir
+		}
+
+		relPath, err := filepath.Rel(setting.InstallRepoPath, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if isRepoRoot(p, relPath) {
+			list = append(list, relPath)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fail to walk local repository: %v", err)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func runListInstalled(ctx *cli.Context) {
+	list, err := getInstalledList()
+	if err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	fmt.Printf("Installed packages (%d):\n", len(list))
+	for _, name := range list {
+		// Revision only be recorded for packages without version suffix.
+		rev := setting.LocalNodes.MustValue(name, "value")
+		if ctx.Bool("verbose") && len(rev) > 0 {
+			fmt.Printf("-> %s @ revision:%s\n", name, rev)
+			continue
+		}
+		fmt.Printf("-> %s\n", name)
+	}
+}
+
 func runList(ctx *cli.Context) {
 	if err := setup(ctx); err != nil {
 		errors.SetError(err)
 		return
 	}
 
+	if ctx.Bool("installed") {
+		runListInstalled(ctx)
+		return
+	}
+
 	if !setting.HasGOPATHSetting && !base.IsFile(setting.DefaultGopmfile) {
 		log.Warn("Dependency list may contain package itself without GOPATH setting and gopmfile.")
 	}
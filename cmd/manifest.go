@@ -0,0 +1,160 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/cae/tz"
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
+	"github.com/gpmgo/gopm/modules/errors"
+	"github.com/gpmgo/gopm/modules/log"
+)
+
+var CmdManifest = cli.Command{
+	Name:  "manifest",
+	Usage: "generate checksum manifest of archives for a mirror",
+	Description: `Command manifest computes SHA256 checksum of every archive
+in given directory and writes them into a manifest file
+
+gopm manifest <directory>
+gopm manifest -o /srv/mirror/checksums.json /srv/mirror
+
+Manifest is a JSON object keyed by path of archive relative to the directory,
+i.e. 'github.com/Unknwon/com-v1.0.0.zip', with its checksum and size,
+so it can be served alongside archives to let clients validate them.
+It is written into the directory as 'manifest.json' by default.`,
+	Action: runManifest,
+	Flags: []cli.Flag{
+		cli.StringFlag{"output, o", "", "path of manifest file to write", ""},
+		cli.BoolFlag{"verbose, v", "show process details", ""},
+	},
+}
+
+// manifestEntry represents an archive in checksum manifest.
+type manifestEntry struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// isArchiveFile returns true if given file name has extension of archive
+// that gopm can extract.
+func isArchiveFile(name string) bool {
+	return strings.HasSuffix(name, ".zip") || len(tz.Format(name)) > 0
+}
+
+// genManifest walks given directory and returns checksum manifest of archives,
+// hidden directories and given manifest file itself are skipped.
+func genManifest(dirPath, outPath string) (map[string]*manifestEntry, error) {
+	entries := make(map[string]*manifestEntry)
+	err := filepath.Walk(dirPath, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if p != dirPath && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isArchiveFile(fi.Name()) || p == outPath {
+			return nil
+		}
+		// Archive may be a link to where it is actually stored.
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if fi, err = os.Stat(p); err != nil || fi.IsDir() {
+				log.Warn("Skipped broken or directory link: %s", p)
+				return nil
+			}
+		}
+
+		sum, err := doc.FileChecksum(p)
+		if err != nil {
+			return fmt.Errorf("fail to compute checksum(%s): %v", p, err)
+		}
+		relPath, err := filepath.Rel(dirPath, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		entries[name] = &manifestEntry{SHA256: sum, Size: fi.Size()}
+		log.Info("%s: %s (%s)", name, sum, base.HumaneSize(fi.Size()))
+		return nil
+	})
+	return entries, err
+}
+
+func runManifest(ctx *cli.Context) {
+	if err := setup(ctx); err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	if len(ctx.Args()) != 1 {
+		errors.SetError(fmt.Errorf("Incorrect number of arguments, please give a directory of archives"))
+		return
+	}
+	dirPath, err := filepath.Abs(ctx.Args()[0])
+	if err != nil {
+		errors.SetError(fmt.Errorf("Fail to get absolute path of directory: %v", err))
+		return
+	}
+	if !base.IsDir(dirPath) {
+		errors.SetError(fmt.Errorf("Directory does not exist or is not a directory: %s", dirPath))
+		return
+	}
+	outPath := ctx.String("output")
+	if len(outPath) == 0 {
+		outPath = path.Join(filepath.ToSlash(dirPath), "manifest.json")
+	}
+	if outPath, err = filepath.Abs(outPath); err != nil {
+		errors.SetError(fmt.Errorf("Fail to get absolute path of manifest: %v", err))
+		return
+	}
+
+	entries, err := genManifest(dirPath, outPath)
+	if err != nil {
+		errors.SetError(err)
+		return
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		errors.SetError(fmt.Errorf("Fail to encode manifest: %v", err))
+		return
+	}
+
+	// Mirror may be serving old manifest while it is being written.
+	tmpPath := outPath + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		errors.SetError(fmt.Errorf("Fail to write manifest: %v", err))
+		return
+	}
+	if err = os.Rename(tmpPath, outPath); err != nil {
+		os.Remove(tmpPath)
+		errors.SetError(fmt.Errorf("Fail to write manifest: %v", err))
+		return
+	}
+	if !log.Quiet {
+		fmt.Printf("Manifest of %d archive(s) saved to %s\n", len(entries), outPath)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
+	"github.com/gpmgo/gopm/modules/errors"
+	"github.com/gpmgo/gopm/modules/log"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+var CmdRemove = cli.Command{
+	Name:  "remove",
+	Usage: "remove package from local repository",
+	Description: `Command remove deletes package from gopm local repository,
+as well as its cached archive
+
+gopm remove <import path>@[<tag|commit|branch>:<value>]
+
+Use '--dry-run, -n' to show what would be deleted without deleting anything.
+Package that other installed packages still import is not deleted
+unless '--force, -f' is given.`,
+	Action: runRemove,
+	Flags: []cli.Flag{
+		cli.BoolFlag{"gopath, g", "remove package from GOPATH as well", ""},
+		cli.BoolFlag{"dry-run, n", "show what would be deleted only", ""},
+		cli.BoolFlag{"force, f", "remove package even if other installed packages still import it", ""},
+		cli.BoolFlag{"verbose, v", "show process details", ""},
+	},
+}
+
+// isImportedBy returns true if any Go source file in given directory
+// imports package of given root path.
+func isImportedBy(dirPath, rootPath string) bool {
+	fset := token.NewFileSet()
+	found := false
+	filepath.Walk(dirPath, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || found {
+			return filepath.SkipDir
+		} else if fi.IsDir() || !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+
+		f, err := parser.ParseFile(fset, p, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		for _, imp := range f.Imports {
+			name, _ := strconv.Unquote(imp.Path.Value)
+			if name == rootPath || strings.HasPrefix(name, rootPath+"/") {
+				found = true
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+func runRemove(ctx *cli.Context) {
+	if err := setup(ctx); err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	if len(ctx.Args()) != 1 {
+		errors.SetError(fmt.Errorf("Incorrect number of arguments for command: should have 1"))
+		return
+	}
+
+	info := ctx.Args()[0]
+	pkgPath := info
+	tp, val := doc.BRANCH, ""
+	if i := strings.Index(info, "@"); i > -1 {
+		pkgPath = info[:i]
+		var err error
+		if tp, val, err = validPkgInfo(info[i+1:]); err != nil {
+			errors.SetError(err)
+			return
+		}
+	}
+	if err := base.ValidateRemotePath(pkgPath); err != nil {
+		errors.SetError(fmt.Errorf("Invalid package(%s): %v", pkgPath, err))
+		return
+	}
+	n := doc.NewNode(pkgPath, tp, val, false)
+	if !n.IsExist() {
+		errors.SetError(fmt.Errorf("Package is not installed: %s", n.VerString()))
+		return
+	}
+
+	// Packages that still depend on it would be broken.
+	list, err := getInstalledList()
+	if err != nil {
+		errors.SetError(err)
+		return
+	}
+	installName := n.RootPath + n.ValSuffix()
+	dependents := make([]string, 0, 2)
+	for _, name := range list {
+		if name != installName && isImportedBy(path.Join(setting.InstallRepoPath, name), n.RootPath) {
+			log.Warn("Package %s still imports %s", name, n.RootPath)
+			dependents = append(dependents, name)
+		}
+	}
+	if len(dependents) > 0 && !ctx.Bool("force") {
+		errors.SetError(fmt.Errorf("Package %s is still imported by %s, use '--force, -f' to remove it anyway",
+			n.VerString(), strings.Join(dependents, ", ")))
+		return
+	}
+
+	// Revision only be recorded for packages without version suffix.
+	name := n.Value
+	if len(name) == 0 {
+		name = setting.LocalNodes.MustValue(n.RootPath, "value")
+	}
+	paths := []string{n.InstallPath}
+	if len(name) > 0 {
+		paths = append(paths, doc.TempArchivePaths(n.RootPath, name)...)
+	}
+	if ctx.Bool("gopath") && setting.HasGOPATHSetting {
+		paths = append(paths, n.InstallGopath)
+	}
+
+	for _, p := range paths {
+		// Archive may be a link to stored one which has been cleaned up.
+		fi, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		if ctx.Bool("dry-run") {
+			fmt.Printf("Would delete %s\n", p)
+			continue
+		}
+		if fi.IsDir() {
+			err = os.RemoveAll(p)
+		} else {
+			err = os.Remove(p)
+		}
+		if err != nil {
+			errors.AppendError(fmt.Errorf("fail to delete %s: %v", p, err))
+			continue
+		}
+		if !log.Quiet {
+			fmt.Printf("Deleted %s\n", p)
+		}
+	}
+	if ctx.Bool("dry-run") || !n.IsEmptyVal() {
+		return
+	}
+
+	setting.LocalNodes.DeleteSection(n.RootPath)
+	if err := setting.SaveLocalNodes(); err != nil {
+		errors.SetError(err)
+	}
+}
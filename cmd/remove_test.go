@@ -0,0 +1,67 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+func TestRemoveImported(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GOPM_REPOS", "")
+	defer func(e *setting.Error) { setting.RuntimeError = e }(setting.RuntimeError)
+
+	repoPath := path.Join(home, ".gopm/repos")
+	files := map[string]string{
+		"github.com/Unknwon/com/com.go": "package com",
+		"github.com/Unknwon/cae/cae.go": "package cae\n\nimport \"github.com/Unknwon/com\"",
+	}
+	for name, body := range files {
+		name = path.Join(repoPath, name)
+		os.MkdirAll(path.Dir(name), os.ModePerm)
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args      []string
+		isRemoved bool
+	}{
+		{[]string{"github.com/Unknwon/com"}, false},
+		{[]string{"-n", "github.com/Unknwon/com"}, false},
+		{[]string{"github.com/Unknwon/cae"}, true},
+		{[]string{"github.com/Unknwon/com"}, true},
+	}
+	for _, test := range tests {
+		setting.RuntimeError = new(setting.Error)
+		if err := runTestCommand(CmdRemove, test.args...); err != nil {
+			t.Fatalf("%v: %v", test.args, err)
+		}
+		pkgPath := path.Join(repoPath, test.args[len(test.args)-1])
+		if _, err := os.Stat(pkgPath); os.IsNotExist(err) != test.isRemoved {
+			t.Errorf("%v: expect package to be removed: %v, got %v", test.args, test.isRemoved, err)
+		}
+		if setting.RuntimeError.HasError == test.isRemoved {
+			t.Errorf("%v: expect error: %v, got %v", test.args, !test.isRemoved, setting.RuntimeError.Fatal)
+		}
+	}
+}
@@ -58,6 +58,11 @@ func validPkgInfo(info string) (doc.RevisionType, string, error) {
 		return doc.BRANCH, "", nil
 	}
 
+	// Version constraint can be given without type.
+	if doc.IsVersionConstraint(info) {
+		return doc.TAG, info, nil
+	}
+
 	infos := strings.Split(info, ":")
 
 	if len(infos) == 2 {
@@ -68,6 +73,12 @@ func validPkgInfo(info string) (doc.RevisionType, string, error) {
 		default:
 			return "", "", fmt.Errorf("invalid node type: %v", tp)
 		}
+		// Value becomes part of install path and argument of version control tool.
+		if err := base.ValidateSafePath(val); err != nil {
+			return "", "", fmt.Errorf("invalid node value(%s): %v", val, err)
+		} else if strings.HasPrefix(val, "-") {
+			return "", "", fmt.Errorf("invalid node value(%s): cannot start with '-'", val)
+		}
 		return tp, val, nil
 	}
 	return "", "", fmt.Errorf("cannot parse dependency version: %v", info)
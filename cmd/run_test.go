@@ -0,0 +1,57 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gpmgo/gopm/modules/doc"
+)
+
+func TestValidPkgInfo(t *testing.T) {
+	tests := []struct {
+		info    string
+		tp      doc.RevisionType
+		val     string
+		isValid bool
+	}{
+		{"", doc.BRANCH, "", true},
+		{"latest", doc.TAG, "latest", true},
+		{">=1.2.0", doc.TAG, ">=1.2.0", true},
+		{"tag:v1.0.0", doc.TAG, "v1.0.0", true},
+		{"branch:release/v2", doc.BRANCH, "release/v2", true},
+		{"commit:6ffaf8a", doc.COMMIT, "6ffaf8a", true},
+		{"tag", "", "", false},
+		{"version:v1.0.0", "", "", false},
+		{"branch:../../etc", "", "", false},
+		{"tag:/tmp", "", "", false},
+		{"branch:--upload-pack=touch", "", "", false},
+		{"commit:-b", "", "", false},
+	}
+	for _, test := range tests {
+		tp, val, err := validPkgInfo(test.info)
+		if !test.isValid {
+			if err == nil {
+				t.Errorf("validPkgInfo(%q): expect error but got %s:%s", test.info, tp, val)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("validPkgInfo(%q): unexpected error: %v", test.info, err)
+		} else if tp != test.tp || val != test.val {
+			t.Errorf("validPkgInfo(%q) = %s:%s, expect %s:%s", test.info, tp, val, test.tp, test.val)
+		}
+	}
+}
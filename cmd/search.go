@@ -0,0 +1,112 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
+	"github.com/gpmgo/gopm/modules/errors"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+var CmdSearch = cli.Command{
+	Name:  "search",
+	Usage: "search packages in gopm registry",
+	Description: `Command search searches packages in gopm registry by given keyword
+
+gopm search <keyword>`,
+	Action: runSearch,
+	Flags: []cli.Flag{
+		cli.IntFlag{"number, n", 10, "maximum number of results to show", ""},
+		cli.BoolFlag{"verbose, v", "show process details", ""},
+	},
+}
+
+// searchResult represents a package returned by gopm registry search API.
+type searchResult struct {
+	ImportPath string `json:"import_path"`
+	Synopsis   string `json:"synopsis"`
+	Latest     string `json:"latest"`
+}
+
+func searchPackages(keyword string, limit int) ([]*searchResult, error) {
+	req, err := http.NewRequestWithContext(doc.Context(), "GET", fmt.Sprintf("%s%s?q=%s&limit=%d",
+		setting.RegistryURL, setting.URL_API_SEARCH, url.QueryEscape(keyword), limit), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doc.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fail to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		var apiErr doc.ApiError
+		if err = json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+			return nil, fmt.Errorf("fail to decode response JSON: %v", err)
+		}
+		return nil, fmt.Errorf("%s", apiErr.Error)
+	}
+
+	var results []*searchResult
+	if err = json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("fail to decode response JSON: %v", err)
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func runSearch(ctx *cli.Context) {
+	if err := setup(ctx); err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	if len(ctx.Args()) != 1 {
+		errors.SetError(fmt.Errorf("Incorrect number of arguments for command: should have 1"))
+		return
+	}
+	limit := ctx.Int("number")
+	if limit <= 0 {
+		errors.SetError(fmt.Errorf("Invalid number of results: %d", limit))
+		return
+	}
+
+	results, err := searchPackages(ctx.Args()[0], limit)
+	if err != nil {
+		errors.SetError(fmt.Errorf("Fail to search packages: %v", err))
+		return
+	}
+
+	fmt.Printf("Found %d package(s):\n", len(results))
+	for _, r := range results {
+		fmt.Printf("-> %s", r.ImportPath)
+		if len(r.Latest) > 0 {
+			fmt.Printf(" @ %s", r.Latest)
+		}
+		fmt.Println()
+		if len(r.Synopsis) > 0 {
+			fmt.Printf("   %s\n", r.Synopsis)
+		}
+	}
+}
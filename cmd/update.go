@@ -38,15 +38,68 @@ var CmdUpdate = cli.Command{
 	Description: `Command update checks updates of resources and gopm itself.
 
 gopm update
+gopm update -p [-n]
 
 Resources will be updated automatically after executed this command,
-but you have to confirm before updaing gopm itself.`,
+but you have to confirm before updaing gopm itself.
+
+Use '--packages, -p' to update all packages in gopm local repository
+that have no fixed version instead.`,
 	Action: runUpdate,
 	Flags: []cli.Flag{
+		cli.BoolFlag{"packages, p", "update all installed packages without fixed version", ""},
+		cli.BoolFlag{"dry-run, n", "show packages would be updated only", ""},
 		cli.BoolFlag{"verbose, v", "show process details", ""},
 	},
 }
 
+// updatePackages updates all packages in local repository that have revision records,
+// packages with fixed version never change so they are skipped.
+func updatePackages(ctx *cli.Context) error {
+	setting.RefreshMetadata = true
+	numUpdated := 0
+	for _, name := range setting.LocalNodes.GetSectionList() {
+		n := doc.NewNode(name, doc.BRANCH, "", false)
+		oldRev := setting.LocalNodes.MustValue(name, "value")
+		if len(oldRev) == 0 || !n.IsExist() {
+			continue
+		}
+
+		if ctx.Bool("dry-run") {
+			apiResp, err := n.LatestRevision()
+			if err != nil {
+				errors.AppendError(fmt.Errorf("fail to check package(%s): %v", name, err))
+				continue
+			}
+			if apiResp.Sha != oldRev {
+				fmt.Printf("-> %s: %s -> %s\n", name, oldRev, apiResp.Sha)
+				numUpdated++
+			}
+			continue
+		}
+
+		n.Revision = oldRev
+		if err := n.DownloadGopm(ctx); err != nil {
+			errors.AppendError(fmt.Errorf("fail to update package(%s): %v", name, err))
+			continue
+		}
+		if n.Revision != oldRev {
+			setting.LocalNodes.SetValue(name, "value", n.Revision)
+			fmt.Printf("-> %s: %s -> %s\n", name, oldRev, n.Revision)
+			numUpdated++
+		}
+	}
+
+	if ctx.Bool("dry-run") {
+		fmt.Printf("%d package(s) would be updated\n", numUpdated)
+		return nil
+	}
+	if !log.Quiet {
+		fmt.Printf("%d package(s) updated\n", numUpdated)
+	}
+	return setting.SaveLocalNodes()
+}
+
 type version struct {
 	Gopm            int `json:"gopm"`
 	PackageNameList int `json:"package_name_list"`
@@ -95,6 +148,13 @@ func runUpdate(ctx *cli.Context) {
 		return
 	}
 
+	if ctx.Bool("packages") {
+		if err := updatePackages(ctx); err != nil {
+			errors.SetError(err)
+		}
+		return
+	}
+
 	isAnythingUpdated := false
 	localVerInfo := loadLocalVerInfo()
 
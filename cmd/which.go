@@ -0,0 +1,178 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
+	"github.com/gpmgo/gopm/modules/errors"
+	"github.com/gpmgo/gopm/modules/log"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+var CmdWhich = cli.Command{
+	Name:  "which",
+	Usage: "show which installed directory of package is used",
+	Description: `Command which shows where package is installed and which one is used
+
+gopm which <import path>|<package name>@[<tag|commit|branch>:<value>]
+
+Every installed copy of package is listed, the one marked with '*' is
+what commands like run and build use, which is looked up in order:
+vendor directory of current project, GOPATH when no version is given,
+then gopm local repository by version suffix like 'github.com/Unknwon/com.v1.0.0'.
+Version in gopmfile of current project is used when none is given.`,
+	Action: runWhich,
+	Flags: []cli.Flag{
+		cli.BoolFlag{"verbose, v", "show process details", ""},
+	},
+}
+
+// installedCopy represents a directory where package is installed.
+type installedCopy struct {
+	Path   string
+	Where  string // One of 'vendor', 'GOPATH' and 'repository'.
+	Ver    string // Version told by suffix or records, empty for unknown.
+	IsUsed bool
+}
+
+// repoCopies returns copies of package in gopm local repository,
+// all versions are directories named by root path with version suffix.
+func repoCopies(rootPath string) []*installedCopy {
+	dir, name := path.Split(path.Join(setting.InstallRepoPath, rootPath))
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	copies := make([]*installedCopy, 0, 2)
+	for _, fi := range fis {
+		if !fi.IsDir() || strings.HasSuffix(fi.Name(), ".tmp") {
+			continue
+		}
+		c := &installedCopy{Path: path.Join(dir, fi.Name()), Where: "repository"}
+		switch {
+		case fi.Name() == name:
+			c.Ver = "latest"
+			if rev := setting.LocalNodes.MustValue(rootPath, "value"); len(rev) > 0 {
+				c.Ver += ", revision " + rev
+			}
+		case strings.HasPrefix(fi.Name(), name+"."):
+			c.Ver = strings.TrimPrefix(fi.Name(), name+".")
+		default:
+			continue
+		}
+		copies = append(copies, c)
+	}
+	return copies
+}
+
+// whichCopies returns all installed copies of package, and marks
+// the one used for its version the same way run command looks up.
+func whichCopies(n *doc.Node) []*installedCopy {
+	copies := make([]*installedCopy, 0, 3)
+	if vendorPath := path.Join(setting.DefaultVendorSrc, n.RootPath); base.IsExist(vendorPath) {
+		copies = append(copies, &installedCopy{Path: vendorPath, Where: "vendor"})
+	}
+	if setting.HasGOPATHSetting && n.IsExistGopath() {
+		c := &installedCopy{Path: n.InstallGopath, Where: "GOPATH"}
+		// Only packages installed by flat layout have version recorded.
+		if record := setting.LocalNodes.MustValue(n.RootPath, "flat"); strings.HasPrefix(record, n.InstallGopath+"@") {
+			c.Ver = strings.TrimPrefix(record, n.InstallGopath+"@")
+		}
+		copies = append(copies, c)
+	}
+	copies = append(copies, repoCopies(n.RootPath)...)
+
+	for _, c := range copies {
+		switch {
+		case c.Where == "vendor",
+			c.Where == "GOPATH" && n.IsEmptyVal(),
+			c.Where == "repository" && c.Path == path.Join(setting.InstallRepoPath, n.RootPath)+n.ValSuffix():
+			c.IsUsed = true
+			return copies
+		}
+	}
+	return copies
+}
+
+func runWhich(ctx *cli.Context) {
+	if err := setup(ctx); err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	if len(ctx.Args()) == 0 {
+		errors.SetError(fmt.Errorf("Not enough arguments, please give at least one package"))
+		return
+	}
+	nodes, err := parsePaths(ctx, nil)
+	if err != nil {
+		errors.SetError(err)
+		return
+	}
+
+	// Version in gopmfile of project is what run command uses.
+	var deps map[string]string
+	if base.IsFile(setting.DefaultGopmfile) {
+		gf, _, err := parseGopmfile(setting.DefaultGopmfile)
+		if err != nil {
+			errors.SetError(err)
+			return
+		}
+		deps, _ = gf.GetSection("deps")
+	}
+
+	for i, n := range nodes {
+		if v := deps[n.RootPath]; n.IsEmptyVal() && len(v) > 0 {
+			if n.Type, n.Value, err = validPkgInfo(v); err != nil {
+				errors.SetError(err)
+				return
+			}
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s%s:\n", n.RootPath, n.VerSuffix())
+		copies := whichCopies(n)
+		isUsed := false
+		for _, c := range copies {
+			mark := " "
+			if c.IsUsed {
+				mark, isUsed = "*", true
+			}
+			desc := c.Where
+			if len(c.Ver) > 0 {
+				desc += ", " + c.Ver
+			}
+			fmt.Printf("%s %s (%s)\n", mark, c.Path, desc)
+		}
+
+		switch {
+		case len(copies) == 0:
+			errors.AppendError(fmt.Errorf("package(%s) is not installed", n.VerString()))
+		case !isUsed:
+			log.Warn("%s is not installed, but other versions are", n.VerString())
+		case len(copies) > 1:
+			log.Warn("%s is installed in %d places, the one marked with '*' is used", n.RootPath, len(copies))
+		}
+	}
+}
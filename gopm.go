@@ -17,14 +17,29 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gpmgo/gopm/lib"
+	"github.com/gpmgo/gopm/modules/doc"
 	"github.com/gpmgo/gopm/modules/log"
 	"github.com/gpmgo/gopm/modules/setting"
 )
 
 func main() {
 	setting.LibraryMode = false
+
+	// First interrupt aborts downloads and cleans up, second one exits immediately.
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Warn("Interrupted, cleaning up...")
+		doc.Interrupt()
+		<-sigs
+		os.Exit(1)
+	}()
+
 	if err := lib.Run(os.Args); err.HasError {
 		if err.Fatal != nil {
 			log.Fatal("%v", err.Fatal)
@@ -32,5 +47,6 @@ func main() {
 		for _, e := range err.Errors {
 			log.Error("%v", e)
 		}
+		os.Exit(1)
 	}
 }
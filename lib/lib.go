@@ -18,11 +18,17 @@
 package lib
 
 import (
+	"fmt"
 	"io"
+	"net/http"
 	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/gpmgo/gopm/cmd"
 	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/doc"
+	"github.com/gpmgo/gopm/modules/errors"
 	"github.com/gpmgo/gopm/modules/log"
 	"github.com/gpmgo/gopm/modules/setting"
 )
@@ -34,7 +40,12 @@ func init() {
 	setting.LibraryMode = true
 }
 
-func Run(args []string) *setting.Error {
+// runLock serializes calls of library, because state of commands
+// and settings are shared by the whole process.
+var runLock sync.Mutex
+
+// newApp returns application with all commands and global flags.
+func newApp() *cli.App {
 	app := cli.NewApp()
 	app.Name = "Gopm"
 	app.Usage = "Go Package Manager"
@@ -51,17 +62,79 @@ func Run(args []string) *setting.Error {
 		cmd.CmdInstall,
 		cmd.CmdClean,
 		cmd.CmdUpdate,
-		// CmdSearch,
+		cmd.CmdSearch,
+		cmd.CmdRemove,
+		cmd.CmdInfo,
+		cmd.CmdGraph,
+		cmd.CmdManifest,
+		cmd.CmdWhich,
+		cmd.CmdDoctor,
+	}
+	app.Flags = append(app.Flags, cmd.GlobalFlags...)
+	return app
+}
+
+func Run(args []string) *setting.Error {
+	runLock.Lock()
+	defer runLock.Unlock()
+	return run(newApp(), args)
+}
+
+func run(app *cli.App, args []string) *setting.Error {
+	if err := app.Run(args); err != nil {
+		errors.SetError(err)
 	}
-	app.Flags = append(app.Flags, []cli.Flag{
-		cli.BoolFlag{"noterm, n", "disable color output", ""},
-		cli.BoolFlag{"strict, s", "strict mode", ""},
-		cli.BoolFlag{"debug, d", "debug mode", ""},
-	}...)
-	app.Run(args)
 	return setting.RuntimeError
 }
 
 func SetOutput(out io.Writer) {
 	log.Output = out
 }
+
+// GetOptions represents options of getting package programmatically.
+type GetOptions struct {
+	Update       bool         // Update package and dependencies if any.
+	DownloadOnly bool         // Download package only, without installing to GOPATH.
+	Gopath       string       // GOPATH to install package into, empty for not installing.
+	Client       *http.Client // HTTP client to use, nil for default one.
+}
+
+// Get fetches given package and its dependencies as command get does,
+// version is in format of '<tag|commit|branch>:<value>', empty for latest.
+// Returned package has revision and checksum of archive it is fetched from.
+func Get(name, ver string, opts GetOptions) (*doc.Pkg, error) {
+	tp, val := doc.BRANCH, ""
+	info := name
+	if len(ver) > 0 {
+		infos := strings.SplitN(ver, ":", 2)
+		if len(infos) != 2 {
+			return nil, fmt.Errorf("cannot parse package version: %s", ver)
+		}
+		tp, val = doc.RevisionType(infos[0]), infos[1]
+		info += "@" + ver
+	}
+
+	runLock.Lock()
+	defer runLock.Unlock()
+
+	setting.RuntimeError = new(setting.Error)
+	nodes, err := cmd.Get([]string{info}, cmd.GetOptions{
+		Update:       opts.Update,
+		DownloadOnly: opts.DownloadOnly,
+		Gopath:       opts.Gopath,
+		Client:       opts.Client,
+	})
+	if err != nil {
+		errors.SetError(err)
+	}
+	if setting.RuntimeError.HasError {
+		return nil, setting.RuntimeError
+	}
+	for _, n := range nodes {
+		if n.Depth == 0 {
+			pkg := n.Pkg
+			return &pkg, nil
+		}
+	}
+	return doc.NewPkg(name, tp, val), nil
+}
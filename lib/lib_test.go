@@ -0,0 +1,144 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package lib
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestRegistry returns a registry that serves package 'a.com/x/a'
+// at revision told by given value, which can be changed between calls.
+func newTestRegistry(t *testing.T, revision *atomic.Value) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rev := revision.Load().(string)
+		if strings.HasSuffix(r.URL.Path, "/revision") {
+			json.NewEncoder(w).Encode(map[string]string{"sha": rev})
+			return
+		}
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+		fw, err := zw.Create("a-master/a.go")
+		if err != nil {
+			t.Error(err)
+		}
+		fw.Write([]byte("package a // " + rev + "\n"))
+		zw.Close()
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(buf.Bytes())
+	}))
+}
+
+func TestGetTwice(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GOPATH", filepath.Join(home, "go"))
+	SetOutput(ioutil.Discard)
+
+	revision := new(atomic.Value)
+	revision.Store("r1")
+	server := newTestRegistry(t, revision)
+	defer server.Close()
+
+	os.MkdirAll(filepath.Join(home, ".gopm/data"), os.ModePerm)
+	cfg := "[settings]\nMIRRORS = " + server.URL + "\n"
+	if err := ioutil.WriteFile(filepath.Join(home, ".gopm/data/gopm.ini"), []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, err := Get("a.com/x/a", "", GetOptions{DownloadOnly: true})
+	if err != nil {
+		t.Fatalf("first Get: %v", err)
+	}
+	if pkg.Revision != "r1" || len(pkg.Checksum) == 0 {
+		t.Errorf("first Get: expect revision r1 with checksum, got %q and %q", pkg.Revision, pkg.Checksum)
+	}
+	firstSum := pkg.Checksum
+
+	// Nothing is left from the previous call, so package is fetched again.
+	revision.Store("r2")
+	if pkg, err = Get("a.com/x/a", "", GetOptions{DownloadOnly: true, Update: true}); err != nil {
+		t.Fatalf("second Get: %v", err)
+	}
+	if pkg.Revision != "r2" || len(pkg.Checksum) == 0 || pkg.Checksum == firstSum {
+		t.Errorf("second Get: expect revision r2 with new checksum, got %q and %q", pkg.Revision, pkg.Checksum)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(home, ".gopm/repos/a.com/x/a/a.go"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(data), "r2") {
+		t.Errorf("second Get: package is not updated: %s", data)
+	}
+}
+
+// countTransport counts requests it sends.
+type countTransport struct {
+	count int32
+}
+
+func (t *countTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGetOptions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GOPATH", filepath.Join(home, "go"))
+	SetOutput(ioutil.Discard)
+
+	revision := new(atomic.Value)
+	revision.Store("r1")
+	server := newTestRegistry(t, revision)
+	defer server.Close()
+
+	os.MkdirAll(filepath.Join(home, ".gopm/data"), os.ModePerm)
+	cfg := "[settings]\nMIRRORS = " + server.URL + "\n"
+	if err := ioutil.WriteFile(filepath.Join(home, ".gopm/data/gopm.ini"), []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := new(countTransport)
+	gopath := filepath.Join(home, "other")
+	os.MkdirAll(gopath, os.ModePerm)
+	if _, err := Get("a.com/x/a", "", GetOptions{
+		Gopath: gopath,
+		Client: &http.Client{Transport: transport},
+	}); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if atomic.LoadInt32(&transport.count) == 0 {
+		t.Error("Get: given client is not used")
+	}
+	if _, err := os.Stat(filepath.Join(gopath, "src/a.com/x/a/a.go")); err != nil {
+		t.Errorf("Get: package is not installed into given GOPATH: %v", err)
+	}
+
+	// Name of package is never taken as option.
+	if _, err := Get("-u", "", GetOptions{DownloadOnly: true}); err == nil {
+		t.Error("Get(-u): expect error but got nil")
+	} else if !strings.HasSuffix(err.Error(), ": -u") {
+		t.Errorf("Get(-u): expect error of package name, got %v", err)
+	}
+}
@@ -15,6 +15,8 @@
 package base
 
 import (
+	"os"
+	"path"
 	"sync"
 )
 
@@ -29,6 +31,17 @@ func (s *SafeMap) Set(verstr string) {
 	s.data[verstr] = true
 }
 
+// SetIfAbsent sets given key and returns true if it has not been set before.
+func (s *SafeMap) SetIfAbsent(verstr string) bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.data[verstr] {
+		return false
+	}
+	s.data[verstr] = true
+	return true
+}
+
 func (s *SafeMap) Get(verstr string) bool {
 	s.locker.RLock()
 	defer s.locker.RUnlock()
@@ -41,3 +54,30 @@ func NewSafeMap() *SafeMap {
 		data:   make(map[string]bool),
 	}
 }
+
+// LockFile acquires exclusive lock of given file across processes,
+// onWait is called before blocking when the lock is held by others.
+// Returned function releases the lock.
+func LockFile(filePath string, onWait func()) (func(), error) {
+	os.MkdirAll(path.Dir(filePath), os.ModePerm)
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := lockFile(f, false)
+	if err == nil && !ok {
+		if onWait != nil {
+			onWait()
+		}
+		_, err = lockFile(f, true)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,30 @@
+// +build linux darwin freebsd dragonfly
+
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package base
+
+import (
+	"syscall"
+)
+
+// FreeSpace returns bytes available to current user in volume of given path.
+func FreeSpace(dirPath string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dirPath, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -24,7 +24,9 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/user"
 	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -114,6 +116,32 @@ func StatDir(rootPath string, includeDir ...bool) ([]string, error) {
 	return statDir(rootPath, "", isIncludeDir, false)
 }
 
+// DirSize returns total size of all files in given path,
+// it returns 0 when the path does not exist.
+func DirSize(dirPath string) (size int64) {
+	filepath.Walk(dirPath, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// HumaneSize returns human readable form of given size in bytes.
+func HumaneSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	val := float64(size)
+	i := 0
+	for ; val >= 1024 && i < len(units)-1; i++ {
+		val /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", size, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", val, units[i])
+}
+
 // Copy copies file from source to target path.
 func Copy(src, dest string) error {
 	// Gather file information to set back later.
@@ -266,19 +294,48 @@ func Expand(template string, match map[string]string, subs ...string) string {
 
 // GetGOPATHs returns all paths in GOPATH variable.
 func GetGOPATHs() []string {
-	gopath := os.Getenv("GOPATH")
-	var paths []string
-	if runtime.GOOS == "windows" {
+	return SplitGOPATH(os.Getenv("GOPATH"))
+}
+
+// SplitGOPATH splits GOPATH value by list separator of current platform,
+// empty entries are dropped.
+func SplitGOPATH(gopath string) []string {
+	return splitGOPATH(gopath, runtime.GOOS == "windows")
+}
+
+func splitGOPATH(gopath string, isWindows bool) []string {
+	sep := ":"
+	if isWindows {
 		gopath = strings.Replace(gopath, "\\", "/", -1)
-		paths = strings.Split(gopath, ";")
-	} else {
-		paths = strings.Split(gopath, ":")
+		sep = ";"
+	}
+	paths := make([]string, 0, 2)
+	for _, p := range strings.Split(gopath, sep) {
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			paths = append(paths, p)
+		}
 	}
 	return paths
 }
 
+// IsWritableDir returns true if given path is a directory
+// that current user can create files in.
+func IsWritableDir(dirPath string) bool {
+	if !IsDir(dirPath) {
+		return false
+	}
+	f, err := ioutil.TempFile(dirPath, ".gopm")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
 // HomeDir returns path of '~'(in Linux) on Windows,
-// it returns error when the variable does not exist.
+// it falls back to current user information when the variable does not exist,
+// and returns error when both of them are not available.
 func HomeDir() (home string, _ error) {
 	if runtime.GOOS == "windows" {
 		home = os.Getenv("HOMEDRIVE") + os.Getenv("HOMEPATH")
@@ -289,6 +346,12 @@ func HomeDir() (home string, _ error) {
 		home = os.Getenv("HOME")
 	}
 
+	if len(home) == 0 {
+		if u, err := user.Current(); err == nil {
+			home = u.HomeDir
+		}
+	}
+
 	if len(home) == 0 {
 		return "", errors.New("Cannot specify home directory because it's empty")
 	}
@@ -296,6 +359,16 @@ func HomeDir() (home string, _ error) {
 	return home, nil
 }
 
+// ExpandHome replaces leading '~' of given path with home directory.
+func ExpandHome(p, home string) string {
+	if p == "~" {
+		return home
+	} else if strings.HasPrefix(p, "~/") || strings.HasPrefix(p, "~\\") {
+		return home + p[1:]
+	}
+	return p
+}
+
 // IsSliceContainsStr returns true if the string exists in given slice.
 func IsSliceContainsStr(sl []string, str string) bool {
 	str = strings.ToLower(str)
@@ -636,26 +709,53 @@ func isValidPathElement(s string) bool {
 
 // IsValidRemotePath returns true if importPath is structurally valid for "go get".
 func IsValidRemotePath(importPath string) bool {
+	return ValidateRemotePath(importPath) == nil
+}
+
+// ValidateSafePath returns an error if given path is absolute or
+// contains '..' segment, which could escape from its parent directory.
+func ValidateSafePath(p string) error {
+	if path.IsAbs(p) || strings.HasPrefix(p, "\\") ||
+		filepath.IsAbs(p) || len(filepath.VolumeName(p)) > 0 {
+		return fmt.Errorf("absolute path is not allowed")
+	}
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return fmt.Errorf("'..' segment is not allowed")
+		}
+	}
+	return nil
+}
+
+// ValidateRemotePath returns an error describing why importPath
+// is not structurally valid for "go get", or nil if it is valid.
+func ValidateRemotePath(importPath string) error {
+	if err := ValidateSafePath(importPath); err != nil {
+		return err
+	}
+
 	parts := strings.Split(importPath, "/")
 	if len(parts) <= 1 {
 		// Import path must contain at least one "/".
-		return false
+		return fmt.Errorf("import path must contain at least one '/'")
 	}
 
 	if !validTLD[path.Ext(parts[0])] {
-		return false
+		return fmt.Errorf("unsupported host '%s'", parts[0])
 	}
 
 	if !validHost.MatchString(parts[0]) {
-		return false
+		return fmt.Errorf("malformed host '%s'", parts[0])
 	}
 
 	for _, part := range parts[1:] {
-		if !isValidPathElement(part) {
-			return false
+		if len(part) == 0 {
+			return fmt.Errorf("empty path segment")
+		} else if !isValidPathElement(part) {
+			return fmt.Errorf("invalid path segment '%s'", part)
 		}
 	}
-	return true
+	return nil
 }
 
 func IsGoTool(path string) bool {
@@ -0,0 +1,41 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package base
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitGOPATH(t *testing.T) {
+	tests := []struct {
+		gopath    string
+		isWindows bool
+		expect    []string
+	}{
+		{"", false, []string{}},
+		{"/home/go", false, []string{"/home/go"}},
+		{"/home/go:/home/work", false, []string{"/home/go", "/home/work"}},
+		{"/home/go::/home/work:", false, []string{"/home/go", "/home/work"}},
+		{`C:\go;D:\work`, true, []string{"C:/go", "D:/work"}},
+		{`C:\go;;D:\work;`, true, []string{"C:/go", "D:/work"}},
+		{`C:\go`, true, []string{"C:/go"}},
+	}
+	for _, test := range tests {
+		if paths := splitGOPATH(test.gopath, test.isWindows); !reflect.DeepEqual(paths, test.expect) {
+			t.Errorf("splitGOPATH(%q, %v): expect %q, got %q", test.gopath, test.isWindows, test.expect, paths)
+		}
+	}
+}
@@ -18,6 +18,8 @@ package cae
 import (
 	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -59,6 +61,112 @@ func IsFilter(name string) bool {
 	return false
 }
 
+// IsInsideDir returns true if given entry name resolves to a path within destPath.
+func IsInsideDir(destPath, name string) bool {
+	absDest, err := filepath.Abs(destPath)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(filepath.Join(absDest, name))
+	if err != nil {
+		return false
+	}
+	return absPath == absDest || strings.HasPrefix(absPath, absDest+string(filepath.Separator))
+}
+
+// IsSafeSymlink returns true if symbolic link of given entry name points to
+// a path within destPath, absolute targets are never safe.
+// Target is resolved from real path of directory that link is in, because links
+// which have been extracted can lead it to anywhere, and '..' is only allowed
+// as leading elements of target so it cannot climb up through another link.
+func IsSafeSymlink(destPath, name, target string) bool {
+	target = strings.Replace(target, "\\", "/", -1)
+	if len(target) == 0 || path.IsAbs(target) || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return false
+	}
+	isLeading := true
+	for _, elem := range strings.Split(target, "/") {
+		switch elem {
+		case "", ".":
+		case "..":
+			if !isLeading {
+				return false
+			}
+		default:
+			isLeading = false
+		}
+	}
+	dir := path.Dir(strings.TrimSuffix(name, "/"))
+	if !IsInsideDir(destPath, path.Join(dir, target)) {
+		return false
+	}
+
+	realDest, err := realPath(destPath)
+	if err != nil {
+		return false
+	}
+	realDir, err := realPath(filepath.Join(destPath, dir))
+	if err != nil {
+		return false
+	}
+	return isInside(realDest, filepath.Join(realDir, filepath.FromSlash(target)))
+}
+
+// IsInsideRealDir is like IsInsideDir but follows symbolic links which have
+// been extracted, so no entry can be written to outside through a link.
+func IsInsideRealDir(destPath, name string) bool {
+	realDest, err := realPath(destPath)
+	if err != nil {
+		return false
+	}
+	realDir, err := realPath(filepath.Join(destPath, filepath.Dir(strings.TrimSuffix(name, "/"))))
+	if err != nil {
+		return false
+	}
+	return isInside(realDest, realDir)
+}
+
+// realPath returns absolute path of given path with symbolic links evaluated,
+// only the part that exists can be resolved, the rest is joined back as it is.
+func realPath(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for !IsExist(p) {
+		parent := filepath.Dir(p)
+		if parent == p {
+			break
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+	if p, err = filepath.EvalSymlinks(p); err != nil {
+		return "", err
+	}
+	if p, err = filepath.Abs(p); err != nil {
+		return "", err
+	}
+	return filepath.Join(p, rest), nil
+}
+
+// isInside returns true if absolute path p is dir or within it.
+func isInside(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// FileMode returns mode of given file entry in archive, permission bits fall back
+// to 0644 when archive does not record any, i.e. zip created on Unix-like systems
+// with zero external attributes, which would leave file unreadable.
+func FileMode(fi os.FileInfo) os.FileMode {
+	mode := fi.Mode()
+	if mode.Perm() == 0 {
+		mode |= 0644
+	}
+	return mode
+}
+
 // IsExist returns true if given path is a file or directory.
 func IsExist(path string) bool {
 	_, err := os.Stat(path)
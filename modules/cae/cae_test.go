@@ -0,0 +1,86 @@
+// Copyright 2013 Unknown
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package cae
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsSafeSymlink(t *testing.T) {
+	destPath := t.TempDir()
+	if err := os.Mkdir(filepath.Join(destPath, "sub"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// Link extracted earlier from the same archive.
+	if err := os.Symlink(".", filepath.Join(destPath, "a")); err != nil {
+		t.Skip("symbolic link is not supported:", err)
+	}
+
+	tests := []struct {
+		name, target string
+		expect       bool
+	}{
+		{"b", "sub", true},
+		{"sub/b", "../a", true},
+		{"sub/b", "./c/d", true},
+		{"a/sub/b", "../sub", true},
+		{"b", "", false},
+		{"b", "..", false},
+		{"b", "/etc/passwd", false},
+		{"sub/b", "..\\..", false},
+		{"sub/b", "../..", false},
+		{"b", "sub/../..", false},
+		{"b", "a/..", false},
+		{"a/b", "..", false},
+		{"a/a/b", "../..", false},
+	}
+	for _, test := range tests {
+		if actual := IsSafeSymlink(destPath, test.name, test.target); actual != test.expect {
+			t.Errorf("IsSafeSymlink(%q, %q) = %v, expect %v", test.name, test.target, actual, test.expect)
+		}
+	}
+}
+
+func TestIsInsideRealDir(t *testing.T) {
+	root := t.TempDir()
+	destPath := filepath.Join(root, "dest")
+	if err := os.Mkdir(destPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(".", filepath.Join(destPath, "a")); err != nil {
+		t.Skip("symbolic link is not supported:", err)
+	}
+	if err := os.Symlink(root, filepath.Join(destPath, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		expect bool
+	}{
+		{"file", true},
+		{"a/file", true},
+		{"a/new/dir/", true},
+		{"out/file", false},
+		{"a/out/file", false},
+	}
+	for _, test := range tests {
+		if actual := IsInsideRealDir(destPath, test.name); actual != test.expect {
+			t.Errorf("IsInsideRealDir(%q) = %v, expect %v", test.name, actual, test.expect)
+		}
+	}
+}
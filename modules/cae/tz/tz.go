@@ -0,0 +1,194 @@
+// Copyright 2014 Unknown
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package tz enables you to extract tarballs compressed with gzip, bzip2 or xz.
+package tz
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/gpmgo/gopm/modules/cae"
+)
+
+// Formats of tarballs that can be extracted, keyed by file extension.
+var formats = []string{".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz", ".tar"}
+
+// Formats returns extensions of all tarball formats that can be extracted.
+func Formats() []string {
+	return append([]string{}, formats...)
+}
+
+// Format returns format extension of given tarball name,
+// it returns empty string if it is not a tarball.
+func Format(name string) string {
+	for _, ext := range formats {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// openXz decompresses given file through xz command,
+// because there is no xz support in standard library.
+func openXz(srcPath string) (io.ReadCloser, func() error, error) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		return nil, nil, errors.New("xz is required to extract .xz archive but not found in PATH")
+	}
+	cmd := exec.Command("xz", "-dc", srcPath)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	return stdout, cmd.Wait, nil
+}
+
+// extractFile extracts current file of tar reader to file system,
+// contents are copied verbatim as zip does.
+func extractFile(tr *tar.Reader, h *tar.Header, filePath string) error {
+	os.MkdirAll(path.Dir(filePath), os.ModePerm)
+
+	mode := cae.FileMode(h.FileInfo())
+	fw, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	if _, err = io.Copy(fw, tr); err != nil {
+		return err
+	}
+
+	// Set back file information.
+	if err = os.Chtimes(filePath, h.ModTime, h.ModTime); err != nil {
+		return err
+	}
+	return os.Chmod(filePath, mode)
+}
+
+// ExtractToFunc extracts the whole tarball to the specified destination,
+// compression is detected by file extension of srcPath.
+// It accepts a function as a middleware for custom operations,
+// entry is skipped when the function returns an error.
+func ExtractToFunc(srcPath, destPath string, fn cae.HookFunc) (err error) {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch Format(srcPath) {
+	case ".tar.gz", ".tgz":
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case ".tar.bz2", ".tbz2":
+		r = bzip2.NewReader(f)
+	case ".tar.xz", ".txz":
+		var xr io.ReadCloser
+		var wait func() error
+		if xr, wait, err = openXz(srcPath); err != nil {
+			return err
+		}
+		defer func() {
+			// Tar reader stops before padding, which has to be drained
+			// or xz will be killed by broken pipe.
+			if err == nil {
+				io.Copy(ioutil.Discard, xr)
+			}
+			xr.Close()
+			if werr := wait(); err == nil && werr != nil {
+				err = fmt.Errorf("xz: %v", werr)
+			}
+		}()
+		r = xr
+	case ".tar":
+	default:
+		return fmt.Errorf("unsupported archive format: %s", path.Base(srcPath))
+	}
+
+	destPath = strings.Replace(destPath, "\\", "/", -1)
+	os.MkdirAll(destPath, os.ModePerm)
+
+	tr := tar.NewReader(r)
+	hasLink := false // Paths have to be resolved once a link is extracted.
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(strings.Replace(h.Name, "\\", "/", -1), "./")
+		if len(name) == 0 {
+			continue
+		}
+		if !cae.IsInsideDir(destPath, name) ||
+			(hasLink && !cae.IsInsideRealDir(destPath, name)) {
+			return fmt.Errorf("illegal file path in archive: %s", h.Name)
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if !strings.HasSuffix(name, "/") {
+				name += "/"
+			}
+			if fn(name, h.FileInfo()) != nil {
+				continue
+			}
+			os.MkdirAll(path.Join(destPath, name), os.ModePerm)
+		case tar.TypeReg:
+			if fn(name, h.FileInfo()) != nil {
+				continue
+			}
+			if err = extractFile(tr, h, path.Join(destPath, name)); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if !cae.IsSafeSymlink(destPath, name, h.Linkname) {
+				return fmt.Errorf("illegal symbolic link in archive: %s -> %s", h.Name, h.Linkname)
+			}
+			if fn(name, h.FileInfo()) != nil {
+				continue
+			}
+			linkPath := path.Join(destPath, name)
+			os.MkdirAll(path.Dir(linkPath), os.ModePerm)
+			os.Remove(linkPath)
+			// File system may not support symbolic link, i.e. Windows without privilege.
+			os.Symlink(h.Linkname, linkPath)
+			hasLink = true
+		default:
+			// Hard links and special files are never part of Go source.
+			continue
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2014 Unknown
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tz
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEntry represents a file to be written into test tarball.
+type testEntry struct {
+	Name     string
+	Body     string
+	Typeflag byte
+	Mode     int64
+}
+
+// writeTestTarball writes given entries into gzipped tarball and returns its path.
+func writeTestTarball(t *testing.T, entries []testEntry) string {
+	tzPath := filepath.Join(t.TempDir(), "test.tar.gz")
+	f, err := os.Create(tzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.Name, Typeflag: e.Typeflag, Mode: e.Mode}
+		switch e.Typeflag {
+		case tar.TypeSymlink:
+			h.Linkname = e.Body
+		case tar.TypeReg:
+			h.Size = int64(len(e.Body))
+		}
+		if err = tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if e.Typeflag == tar.TypeReg {
+			if _, err = tw.Write([]byte(e.Body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tzPath
+}
+
+func noopHook(string, os.FileInfo) error { return nil }
+
+func TestExtractToFuncSymlink(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink(".", filepath.Join(root, "probe")); err != nil {
+		t.Skip("symbolic link is not supported:", err)
+	}
+
+	tests := []struct {
+		desc    string
+		entries []testEntry
+		isSafe  bool
+	}{
+		{"link to sibling", []testEntry{
+			{"sub/a.go", "package sub", tar.TypeReg, 0644},
+			{"link", "sub/a.go", tar.TypeSymlink, 0777},
+			{"sub/up", "../link", tar.TypeSymlink, 0777},
+		}, true},
+		{"link to parent", []testEntry{
+			{"link", "..", tar.TypeSymlink, 0777},
+		}, false},
+		{"absolute link", []testEntry{
+			{"link", "/etc", tar.TypeSymlink, 0777},
+		}, false},
+		{"chained links", []testEntry{
+			{"a", ".", tar.TypeSymlink, 0777},
+			{"a/b", "..", tar.TypeSymlink, 0777},
+		}, false},
+		{"climb through link", []testEntry{
+			{"a", ".", tar.TypeSymlink, 0777},
+			{"b", "a/..", tar.TypeSymlink, 0777},
+		}, false},
+		{"write through link", []testEntry{
+			{"sub/", "", tar.TypeDir, 0755},
+			{"a", "sub", tar.TypeSymlink, 0777},
+			{"a/../../evil", "escaped", tar.TypeReg, 0644},
+		}, false},
+	}
+	for _, test := range tests {
+		destPath := filepath.Join(t.TempDir(), "dest")
+		err := ExtractToFunc(writeTestTarball(t, test.entries), destPath, noopHook)
+		if test.isSafe && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+		} else if !test.isSafe && err == nil {
+			t.Errorf("%s: expect error but got none", test.desc)
+		}
+		if _, err = os.Lstat(filepath.Join(filepath.Dir(destPath), "evil")); err == nil {
+			t.Errorf("%s: file is written outside of destination", test.desc)
+		}
+	}
+}
+
+func TestExtractToFuncVerbatim(t *testing.T) {
+	contents := map[string]string{
+		"pkg/crlf.go":   "package pkg\r\n\r\nfunc A() {}\r\n",
+		"pkg/lf.go":     "package pkg\n\nfunc B() {}\n",
+		"pkg/mixed.txt": "line1\r\nline2\nline3\r\rend",
+		"pkg/bin.dat":   "\x00\x01\xff\xfe\r\n\x1a\n\r\x00",
+		"pkg/notrail":   "  no trailing newline  ",
+	}
+	entries := make([]testEntry, 0, len(contents))
+	for name, body := range contents {
+		entries = append(entries, testEntry{name, body, tar.TypeReg, 0644})
+	}
+
+	destPath := t.TempDir()
+	if err := ExtractToFunc(writeTestTarball(t, entries), destPath, noopHook); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range contents {
+		data, err := ioutil.ReadFile(filepath.Join(destPath, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !bytes.Equal(data, []byte(body)) {
+			t.Errorf("%s: content changed by extraction: %q, expect %q", name, data, body)
+		}
+	}
+}
+
+func TestExtractToFuncEmptyDir(t *testing.T) {
+	entries := []testEntry{
+		{"pkg/", "", tar.TypeDir, 0755},
+		{"pkg/main.go", "package main", tar.TypeReg, 0644},
+		{"pkg/plugins/", "", tar.TypeDir, 0755},
+		{"pkg/assets", "", tar.TypeDir, 0755},
+		{"./pkg/a/b/c", "", tar.TypeDir, 0755},
+	}
+	destPath := t.TempDir()
+	if err := ExtractToFunc(writeTestTarball(t, entries), destPath, noopHook); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pkg/plugins", "pkg/assets", "pkg/a/b/c"} {
+		fi, err := os.Stat(filepath.Join(destPath, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !fi.IsDir() {
+			t.Errorf("%s: expect directory but got mode %v", name, fi.Mode())
+		}
+	}
+}
+
+func TestExtractToFuncFileMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   int64
+		expect os.FileMode
+	}{
+		{"run.sh", 0755, 0755},
+		{"main.go", 0644, 0644},
+		{"private", 0600, 0600},
+		{"zero.go", 0, 0644},
+	}
+	entries := make([]testEntry, len(tests))
+	for i, test := range tests {
+		entries[i] = testEntry{test.name, "", tar.TypeReg, test.mode}
+	}
+	destPath := t.TempDir()
+	if err := ExtractToFunc(writeTestTarball(t, entries), destPath, noopHook); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		fi, err := os.Stat(filepath.Join(destPath, test.name))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if fi.Mode().Perm() != test.expect {
+			t.Errorf("%s: mode is %v, expect %v", test.name, fi.Mode().Perm(), test.expect)
+		}
+	}
+}
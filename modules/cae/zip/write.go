@@ -18,10 +18,12 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/gpmgo/gopm/modules/cae"
 )
@@ -29,7 +31,13 @@ import (
 // Switcher of printing trace information when pack and extract.
 var Verbose = true
 
+// MaxWorkers is the maximum number of files to be extracted concurrently,
+// each of them is streamed to disk so memory usage is constant per file.
+var MaxWorkers = 1
+
 // extractFile extracts zip.File to file system.
+// Contents are copied verbatim, without any newline translation,
+// because checksums of sources and test fixtures depend on exact bytes.
 func extractFile(f *zip.File, destPath string) error {
 	filePath := path.Join(destPath, f.Name)
 	os.MkdirAll(path.Dir(filePath), os.ModePerm)
@@ -40,7 +48,8 @@ func extractFile(f *zip.File, destPath string) error {
 	}
 	defer rc.Close()
 
-	fw, err := os.Create(filePath)
+	mode := cae.FileMode(f.FileInfo())
+	fw, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
 	if err != nil {
 		return err
 	}
@@ -50,15 +59,38 @@ func extractFile(f *zip.File, destPath string) error {
 		return err
 	}
 
-	// Skip symbolic links.
-	if f.FileInfo().Mode()&os.ModeSymlink != 0 {
-		return nil
-	}
 	// Set back file information.
 	if err = os.Chtimes(filePath, f.ModTime(), f.ModTime()); err != nil {
 		return err
 	}
-	return os.Chmod(filePath, f.FileInfo().Mode())
+	return os.Chmod(filePath, mode)
+}
+
+// maxLinkSize is the maximum length of target of symbolic link.
+const maxLinkSize = 4096
+
+// symlinkTarget returns target of symbolic link, which is stored as content.
+func symlinkTarget(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	target, err := ioutil.ReadAll(io.LimitReader(rc, maxLinkSize))
+	if err != nil {
+		return "", err
+	}
+	return string(target), nil
+}
+
+// extractSymlink creates symbolic link of given name to target.
+func extractSymlink(destPath, name, target string) {
+	linkPath := path.Join(destPath, name)
+	os.MkdirAll(path.Dir(linkPath), os.ModePerm)
+	os.Remove(linkPath)
+	// File system may not support symbolic link, i.e. Windows without privilege.
+	os.Symlink(target, linkPath)
 }
 
 var defaultExtractFunc = func(fullName string, fi os.FileInfo) error {
@@ -80,8 +112,65 @@ func (z *ZipArchive) ExtractToFunc(destPath string, fn cae.HookFunc, entries ...
 		fmt.Println("Unzipping " + z.FileName + "...")
 	}
 	os.MkdirAll(destPath, os.ModePerm)
+
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		fileErr error
+		workers = make(chan struct{}, maxWorkers())
+		hasLink bool // Paths have to be resolved once a link is extracted.
+	)
+	extract := func(f *zip.File) {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			if err := extractFile(f, destPath); err != nil {
+				lock.Lock()
+				if fileErr == nil {
+					fileErr = err
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
 	for _, f := range z.File {
 		f.Name = strings.Replace(f.Name, "\\", "/", -1)
+		// Some tools mark directory by mode without trailing slash,
+		// which must not be extracted as an empty file.
+		if f.FileInfo().IsDir() && !strings.HasSuffix(f.Name, "/") {
+			f.Name += "/"
+		}
+		if !cae.IsInsideDir(destPath, f.Name) ||
+			(hasLink && !cae.IsInsideRealDir(destPath, f.Name)) {
+			wg.Wait()
+			return fmt.Errorf("illegal file path in archive: %s", f.Name)
+		}
+
+		// Symbolic link.
+		if f.FileInfo().Mode()&os.ModeSymlink != 0 {
+			var target string
+			if target, err = symlinkTarget(f); err != nil {
+				wg.Wait()
+				return err
+			} else if !cae.IsSafeSymlink(destPath, f.Name, target) {
+				wg.Wait()
+				return fmt.Errorf("illegal symbolic link in archive: %s -> %s", f.Name, target)
+			}
+			if isHasEntry && !cae.IsEntry(f.Name, entries) {
+				continue
+			}
+			if err = fn(f.Name, f.FileInfo()); err != nil {
+				continue
+			}
+			extractSymlink(destPath, f.Name, target)
+			hasLink = true
+			continue
+		}
 
 		// Directory.
 		if strings.HasSuffix(f.Name, "/") {
@@ -102,24 +191,31 @@ func (z *ZipArchive) ExtractToFunc(destPath string, fn cae.HookFunc, entries ...
 		}
 
 		// File.
-		if isHasEntry {
-			if cae.IsEntry(f.Name, entries) {
-				if err = fn(f.Name, f.FileInfo()); err != nil {
-					continue
-				}
-				err = extractFile(f, destPath)
-			}
-		} else {
-			if err = fn(f.Name, f.FileInfo()); err != nil {
-				continue
-			}
-			err = extractFile(f, destPath)
+		if isHasEntry && !cae.IsEntry(f.Name, entries) {
+			continue
 		}
+		if err = fn(f.Name, f.FileInfo()); err != nil {
+			continue
+		}
+		extract(f)
+
+		lock.Lock()
+		err = fileErr
+		lock.Unlock()
 		if err != nil {
-			return err
+			break
 		}
 	}
-	return nil
+	wg.Wait()
+	return fileErr
+}
+
+// maxWorkers returns valid number of concurrent workers.
+func maxWorkers() int {
+	if MaxWorkers < 1 {
+		return 1
+	}
+	return MaxWorkers
 }
 
 // ExtractToFunc extracts the whole archive or the given files to the
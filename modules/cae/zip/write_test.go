@@ -0,0 +1,236 @@
+// Copyright 2013 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package zip
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func init() {
+	Verbose = false
+}
+
+// testEntry represents a file to be written into test archive.
+type testEntry struct {
+	Name string
+	Body string
+	Mode os.FileMode
+}
+
+// writeTestZip writes given entries into zip archive and returns its path.
+func writeTestZip(t *testing.T, entries []testEntry) string {
+	zipPath := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		fh := &zip.FileHeader{Name: e.Name, Method: zip.Deflate}
+		fh.SetMode(e.Mode)
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(e.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+func TestExtractToSymlink(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink(".", filepath.Join(root, "probe")); err != nil {
+		t.Skip("symbolic link is not supported:", err)
+	}
+
+	tests := []struct {
+		desc    string
+		entries []testEntry
+		isSafe  bool
+	}{
+		{"link to sibling", []testEntry{
+			{"sub/a.go", "package sub", 0644},
+			{"link", "sub/a.go", os.ModeSymlink | 0777},
+			{"sub/up", "../link", os.ModeSymlink | 0777},
+		}, true},
+		{"link to parent", []testEntry{
+			{"link", "..", os.ModeSymlink | 0777},
+		}, false},
+		{"absolute link", []testEntry{
+			{"link", "/etc", os.ModeSymlink | 0777},
+		}, false},
+		{"chained links", []testEntry{
+			{"a", ".", os.ModeSymlink | 0777},
+			{"a/b", "..", os.ModeSymlink | 0777},
+		}, false},
+		{"climb through link", []testEntry{
+			{"a", ".", os.ModeSymlink | 0777},
+			{"b", "a/..", os.ModeSymlink | 0777},
+		}, false},
+		{"write through link", []testEntry{
+			{"a", "sub", os.ModeSymlink | 0777},
+			{"sub/", "", os.ModeDir | 0755},
+			{"a/../../evil", "escaped", 0644},
+		}, false},
+	}
+	for _, test := range tests {
+		destPath := filepath.Join(t.TempDir(), "dest")
+		err := ExtractTo(writeTestZip(t, test.entries), destPath)
+		if test.isSafe && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+		} else if !test.isSafe && err == nil {
+			t.Errorf("%s: expect error but got none", test.desc)
+		}
+		if _, err = os.Lstat(filepath.Join(filepath.Dir(destPath), "evil")); err == nil {
+			t.Errorf("%s: file is written outside of destination", test.desc)
+		}
+	}
+}
+
+func TestExtractToVerbatim(t *testing.T) {
+	contents := map[string]string{
+		"pkg/crlf.go":   "package pkg\r\n\r\nfunc A() {}\r\n",
+		"pkg/lf.go":     "package pkg\n\nfunc B() {}\n",
+		"pkg/mixed.txt": "line1\r\nline2\nline3\r\rend",
+		"pkg/bin.dat":   "\x00\x01\xff\xfe\r\n\x1a\n\r\x00",
+		"pkg/notrail":   "  no trailing newline  ",
+	}
+	entries := make([]testEntry, 0, len(contents))
+	for name, body := range contents {
+		entries = append(entries, testEntry{name, body, 0644})
+	}
+
+	destPath := t.TempDir()
+	if err := ExtractTo(writeTestZip(t, entries), destPath); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range contents {
+		data, err := ioutil.ReadFile(filepath.Join(destPath, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !bytes.Equal(data, []byte(body)) {
+			t.Errorf("%s: content changed by extraction: %q, expect %q", name, data, body)
+		}
+	}
+}
+
+func TestExtractToEmptyDir(t *testing.T) {
+	entries := []testEntry{
+		{"pkg/", "", os.ModeDir | 0755},
+		{"pkg/main.go", "package main", 0644},
+		{"pkg/plugins/", "", os.ModeDir | 0755},
+		// Some tools mark directory by mode only, without trailing slash.
+		{"pkg/assets", "", os.ModeDir | 0755},
+		{"pkg/a/b/c/", "", os.ModeDir | 0755},
+	}
+	destPath := t.TempDir()
+	if err := ExtractTo(writeTestZip(t, entries), destPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pkg/plugins", "pkg/assets", "pkg/a/b/c"} {
+		fi, err := os.Stat(filepath.Join(destPath, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !fi.IsDir() {
+			t.Errorf("%s: expect directory but got mode %v", name, fi.Mode())
+		}
+	}
+}
+
+func TestExtractToFileMode(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	tests := []struct {
+		name   string
+		mode   os.FileMode
+		expect os.FileMode
+	}{
+		{"run.sh", 0755, 0755},
+		{"main.go", 0644, 0644},
+		{"private", 0600, 0600},
+		// Created on Unix-like systems without external attributes.
+		{"zero.go", 0, 0644},
+	}
+	for _, test := range tests {
+		fh := &zip.FileHeader{Name: test.name, Method: zip.Deflate}
+		if test.mode == 0 {
+			fh.CreatorVersion = 3 << 8 // Unix
+		} else {
+			fh.SetMode(test.mode)
+		}
+		if _, err = zw.CreateHeader(fh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	destPath := t.TempDir()
+	if err = ExtractTo(zipPath, destPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		fi, err := os.Stat(filepath.Join(destPath, test.name))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if fi.Mode().Perm() != test.expect {
+			t.Errorf("%s: mode is %v, expect %v", test.name, fi.Mode().Perm(), test.expect)
+		}
+	}
+}
+
+func TestExtractToIllegalPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		isValid bool
+	}{
+		{"pkg/a.go", true},
+		{"pkg/../a.go", true},
+		{"../../evil", false},
+		{"pkg/../../evil", false},
+		{"..\\..\\evil", false},
+		{"pkg/./../../../evil", false},
+	}
+	for _, test := range tests {
+		destPath := filepath.Join(t.TempDir(), "a", "b")
+		err := ExtractTo(writeTestZip(t, []testEntry{{test.name, "evil", 0644}}), destPath)
+		if test.isValid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if !test.isValid && err == nil {
+			t.Errorf("%s: expect error but got none", test.name)
+		}
+		if _, err = os.Stat(filepath.Join(destPath, "../../evil")); err == nil {
+			t.Errorf("%s: file is written outside of destination", test.name)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"strings"
@@ -55,20 +56,9 @@ func (c Command) Run(ctx *Context) error {
 	set := flagSet(c.Name, c.Flags)
 	set.SetOutput(ioutil.Discard)
 
-	firstFlagIndex := -1
-	for index, arg := range ctx.Args() {
-		if strings.HasPrefix(arg, "-") {
-			firstFlagIndex = index
-			break
-		}
-	}
-
 	var err error
-	if firstFlagIndex > -1 && !c.SkipFlagParsing {
-		args := ctx.Args()
-		regularArgs := args[1:firstFlagIndex]
-		flagArgs := args[firstFlagIndex:]
-		err = set.Parse(append(flagArgs, regularArgs...))
+	if !c.SkipFlagParsing {
+		err = set.Parse(reorderArgs(set, ctx.Args().Tail()))
 	} else {
 		err = set.Parse(ctx.Args().Tail())
 	}
@@ -102,6 +92,48 @@ func (c Command) Run(ctx *Context) error {
 	return nil
 }
 
+// reorderArgs moves flags in front of regular arguments, so flags can be
+// given before or after them. Order of regular arguments is kept, and
+// everything after "--" is treated as regular arguments.
+func reorderArgs(set *flag.FlagSet, args []string) []string {
+	flagArgs := make([]string, 0, len(args))
+	regularArgs := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			regularArgs = append(regularArgs, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			regularArgs = append(regularArgs, arg)
+			continue
+		}
+
+		flagArgs = append(flagArgs, arg)
+		if strings.Contains(arg, "=") {
+			continue
+		}
+		// Non-boolean flag takes next argument as its value.
+		f := set.Lookup(strings.TrimLeft(arg, "-"))
+		if f == nil {
+			continue
+		}
+		if bf, ok := f.Value.(interface {
+			IsBoolFlag() bool
+		}); ok && bf.IsBoolFlag() {
+			continue
+		}
+		if i+1 < len(args) {
+			i++
+			flagArgs = append(flagArgs, args[i])
+		}
+	}
+	if len(regularArgs) == 0 {
+		return flagArgs
+	}
+	return append(append(flagArgs, "--"), regularArgs...)
+}
+
 // Returns true if Command.Name or Command.ShortName matches given name
 func (c Command) HasName(name string) bool {
 	return c.Name == name || c.ShortName == name
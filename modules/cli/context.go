@@ -75,6 +75,11 @@ func (c *Context) GlobalInt(name string) int {
 	return lookupInt(name, c.globalSet)
 }
 
+// Looks up the value of a global float64 flag, returns 0 if no float64 flag exists
+func (c *Context) GlobalFloat64(name string) float64 {
+	return lookupFloat64(name, c.globalSet)
+}
+
 // Looks up the value of a global time.Duration flag, returns 0 if no time.Duration flag exists
 func (c *Context) GlobalDuration(name string) time.Duration {
 	return lookupDuration(name, c.globalSet)
@@ -116,6 +121,19 @@ func (c *Context) IsSet(name string) bool {
 	return c.setFlags[name] == true
 }
 
+// Determines if the global flag was actually set
+func (c *Context) GlobalIsSet(name string) bool {
+	isSet := false
+	if c.globalSet != nil {
+		c.globalSet.Visit(func(f *flag.Flag) {
+			if f.Name == name {
+				isSet = true
+			}
+		})
+	}
+	return isSet
+}
+
 // Returns a slice of flag names used in this context.
 func (c *Context) FlagNames() (names []string) {
 	for _, flag := range c.Command.Flags {
@@ -295,8 +313,13 @@ func normalizeFlags(flags []Flag, set *flag.FlagSet) error {
 		for _, name := range parts {
 			name = strings.Trim(name, " ")
 			if visited[name] {
+				// Repeating a flag in another form is harmless as long as
+				// it means the same, e.g. '-u --update'.
 				if ff != nil {
-					return errors.New("Cannot use two forms of the same flag: " + name + " " + ff.Name)
+					if ff.Value.String() != set.Lookup(name).Value.String() {
+						return errors.New("Conflicting values for two forms of the same flag: " + name + " " + ff.Name)
+					}
+					continue
 				}
 				ff = set.Lookup(name)
 			}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestNormalizeFlags(t *testing.T) {
+	flags := []Flag{
+		BoolFlag{Name: "update, u"},
+		StringFlag{Name: "tags, t"},
+	}
+	tests := []struct {
+		args    []string
+		update  bool
+		tags    string
+		isValid bool
+	}{
+		{[]string{}, false, "", true},
+		{[]string{"-u"}, true, "", true},
+		{[]string{"pkg", "--update"}, true, "", true},
+		{[]string{"-u", "-u"}, true, "", true},
+		{[]string{"-u", "--update"}, true, "", true},
+		{[]string{"-t", "a", "--tags", "a"}, false, "a", true},
+		{[]string{"--update=false", "-u"}, false, "", false},
+		{[]string{"-t", "a", "--tags", "b"}, false, "", false},
+		{[]string{"-x"}, false, "", false},
+		{[]string{"--unknown"}, false, "", false},
+	}
+	for _, test := range tests {
+		set := flagSet("test", flags)
+		set.SetOutput(ioutil.Discard)
+		err := set.Parse(reorderArgs(set, test.args))
+		if err == nil {
+			err = normalizeFlags(flags, set)
+		}
+		if !test.isValid {
+			if err == nil {
+				t.Errorf("%v: expect error, got nil", test.args)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.args, err)
+			continue
+		}
+
+		c := NewContext(nil, set, nil)
+		if c.Bool("update") != test.update || c.Bool("u") != test.update {
+			t.Errorf("%v: expect update to be %v, got %v and %v", test.args, test.update, c.Bool("update"), c.Bool("u"))
+		}
+		if c.String("tags") != test.tags || c.String("t") != test.tags {
+			t.Errorf("%v: expect tags to be %q, got %q and %q", test.args, test.tags, c.String("tags"), c.String("t"))
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+// authorization is the Authorization header sent to registry and its mirrors.
+// It must never be logged.
+var authorization string
+
+// SetAuth sets credentials to access private registry and mirrors,
+// value is either 'user:pass' for basic auth or a complete
+// Authorization header value like 'Bearer <token>'.
+func SetAuth(val string) {
+	switch {
+	case len(val) == 0:
+		authorization = ""
+	case strings.Contains(val, " "):
+		authorization = val
+	default:
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(val))
+	}
+}
+
+// isRegistryHost returns true if given host is registry, one of its mirrors
+// or host of URL templates, credentials are never sent to any other host.
+func isRegistryHost(host string) bool {
+	for _, rawURL := range setting.RegistryURLs() {
+		if u, err := url.Parse(rawURL); err == nil && u.Host == host {
+			return true
+		}
+	}
+	r := strings.NewReplacer("{name}", "x", "{ver}", "x", "{verid}", "x")
+	for _, tpl := range setting.URLTemplates {
+		if u, err := url.Parse(r.Replace(tpl)); err == nil && u.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// addAuth returns a copy of request with credentials of its host,
+// or the request itself if there is nothing to add.
+func addAuth(req *http.Request) *http.Request {
+	if len(req.Header.Get("Authorization")) > 0 || !isRegistryHost(req.URL.Host) {
+		return req
+	}
+
+	auth := authorization
+	if len(auth) == 0 {
+		login, password, ok := netrcLookup(req.URL.Hostname())
+		if !ok {
+			return req
+		}
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(login+":"+password))
+	}
+
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", auth)
+	return r
+}
+
+// netrcLookup returns login and password of given host in .netrc file,
+// entry of 'default' is used when there is no exact match.
+func netrcLookup(host string) (login, password string, ok bool) {
+	netrcPath := os.Getenv("NETRC")
+	if len(netrcPath) == 0 {
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		netrcPath = path.Join(setting.HomeDir, name)
+	}
+	data, err := ioutil.ReadFile(netrcPath)
+	if err != nil {
+		return "", "", false
+	}
+
+	var (
+		fields              = strings.Fields(string(data))
+		machine             string
+		isDefault, isFound  bool
+		defLogin, defPasswd string
+		hasDefault          bool
+	)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if isFound {
+				return login, password, true
+			}
+			isDefault = false
+			if i+1 < len(fields) {
+				i++
+				machine = fields[i]
+				isFound = machine == host
+			}
+		case "default":
+			if isFound {
+				return login, password, true
+			}
+			isDefault, hasDefault = true, true
+		case "login", "password":
+			if i+1 >= len(fields) {
+				break
+			}
+			key := fields[i]
+			i++
+			switch {
+			case isFound && key == "login":
+				login = fields[i]
+			case isFound:
+				password = fields[i]
+			case isDefault && key == "login":
+				defLogin = fields[i]
+			case isDefault:
+				defPasswd = fields[i]
+			}
+		}
+	}
+	if isFound {
+		return login, password, true
+	}
+	return defLogin, defPasswd, hasDefault
+}
+
+// redactURL hides password in given URL, so that it can be logged safely.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestAddAuth(t *testing.T) {
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Header.Get("Authorization") {
+		case basic, "Bearer token":
+			w.Write([]byte("archive"))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		auth   string
+		netrc  string
+		status int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"user:wrong", "", http.StatusUnauthorized},
+		{"user:pass", "", http.StatusOK},
+		{"Bearer token", "", http.StatusOK},
+		{"", fmt.Sprintf("machine %s login user password pass", u.Hostname()), http.StatusOK},
+		{"", "machine example.com login user password pass\ndefault login user password pass", http.StatusOK},
+		{"", "machine example.com login user password pass", http.StatusUnauthorized},
+		{"user:pass", "default login user password wrong", http.StatusOK},
+	}
+	defer SetAuth("")
+	for _, test := range tests {
+		setupTestHome(t, srv.URL)
+		netrcPath := path.Join(t.TempDir(), ".netrc")
+		if err := ioutil.WriteFile(netrcPath, []byte(test.netrc), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("NETRC", netrcPath)
+		SetAuth(test.auth)
+
+		_, _, _, err := fetchArchive(HttpClient, srv.URL+"/archive.zip", path.Join(t.TempDir(), "archive.zip"), 0, nil)
+		switch {
+		case test.status == http.StatusOK && err != nil:
+			t.Errorf("auth %q, netrc %q: unexpected error: %v", test.auth, test.netrc, err)
+		case test.status != http.StatusOK && (err == nil || !strings.Contains(err.Error(), "401")):
+			t.Errorf("auth %q, netrc %q: expect 401 error, got %v", test.auth, test.netrc, err)
+		}
+	}
+}
+
+func TestAddAuthOtherHost(t *testing.T) {
+	var header string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header = req.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+	setupTestHome(t, "https://gopm.example.com")
+	defer SetAuth("")
+	SetAuth("user:pass")
+
+	resp, err := HttpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(header) > 0 {
+		t.Errorf("credentials are sent to host other than registry: %q", header)
+	}
+}
@@ -15,11 +15,13 @@
 package doc
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/gpmgo/gopm/modules/log"
@@ -39,10 +41,48 @@ type transport struct {
 	t http.Transport
 }
 
+// hostLimiter limits requests per second to each host,
+// zero rate means unlimited.
+type hostLimiter struct {
+	lock sync.Mutex
+	rate float64
+	next map[string]time.Time
+}
+
+// Wait blocks until a request to given host is allowed.
+func (l *hostLimiter) Wait(host string) {
+	l.lock.Lock()
+	if l.rate <= 0 {
+		l.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	next, ok := l.next[host]
+	if !ok || next.Before(now) {
+		next = now
+	}
+	l.next[host] = next.Add(time.Duration(float64(time.Second) / l.rate))
+	l.lock.Unlock()
+
+	time.Sleep(next.Sub(now))
+}
+
+var limiter = &hostLimiter{next: make(map[string]time.Time)}
+
+// SetRateLimit sets maximum number of requests per second to each host,
+// zero or negative value means unlimited.
+func SetRateLimit(rate float64) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	limiter.rate = rate
+}
+
 func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = addAuth(req)
+	limiter.Wait(req.URL.Host)
 	timer := time.AfterFunc(*requestTimeout, func() {
 		t.t.CancelRequest(req)
-		log.Warn("Canceled request for %s, please interrupt the program.", req.URL)
+		log.Warn("Canceled request for %s, please interrupt the program.", redactURL(req.URL.String()))
 	})
 	defer timer.Stop()
 	resp, err := t.t.RoundTrip(req)
@@ -67,15 +107,44 @@ func (t *transport) SetProxy(proxy string) error {
 }
 
 var (
+	// All requests in a run share the transport, so connections to the same
+	// host are kept alive and reused. HTTP/2 has to be asked for explicitly
+	// because of custom dialer.
 	httpTransport = &transport{
 		t: http.Transport{
-			Dial: timeoutDial,
+			Proxy:                 http.ProxyFromEnvironment,
+			Dial:                  timeoutDial,
+			TLSHandshakeTimeout:   *dialTimeout,
 			ResponseHeaderTimeout: *requestTimeout / 2,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   setting.MaxIdleConnsPerHost,
+			IdleConnTimeout:       90 * time.Second,
 		},
 	}
 	HttpClient = &http.Client{Transport: httpTransport}
+
+	// IsInsecure indicates whether insecure connections are allowed.
+	IsInsecure bool
 )
 
 func SetProxy(proxy string) error {
 	return httpTransport.SetProxy(proxy)
 }
+
+// SetMaxIdleConnsPerHost sets maximum number of idle connections
+// kept to each host, heavy mirror users may want more.
+func SetMaxIdleConnsPerHost(num int) {
+	httpTransport.t.MaxIdleConnsPerHost = num
+}
+
+// SetInsecure makes client skip TLS certificate verification,
+// it should only be used for self-hosted mirrors with bad certificates.
+func SetInsecure(insecure bool) {
+	IsInsecure = insecure
+	if insecure {
+		httpTransport.t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	} else {
+		httpTransport.t.TLSClientConfig = nil
+	}
+}
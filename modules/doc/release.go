@@ -0,0 +1,125 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/log"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+// ReleaseAsset represents a prebuilt file attached to a release of package.
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	URL  string `json:"browser_download_url"`
+}
+
+// releaseAPIs returns URL of releases API of host for given repository path
+// without host and tag, empty tag for latest release.
+var releaseAPIs = map[string]func(repoPath, tag string) string{
+	"github.com": func(repoPath, tag string) string {
+		if len(tag) == 0 {
+			return fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", repoPath)
+		}
+		return fmt.Sprintf("https://api.github.com/repos/%s/releases/tags/%s", repoPath, tag)
+	},
+}
+
+// FindReleaseAsset returns release asset of package whose name matches
+// given glob pattern, latest release is used unless package has a tag.
+func (n *Node) FindReleaseAsset(pattern string) (*ReleaseAsset, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid asset pattern(%s): %v", pattern, err)
+	}
+	infos := strings.SplitN(n.RootPath, "/", 2)
+	apiURL, ok := releaseAPIs[infos[0]]
+	if !ok || len(infos) < 2 {
+		return nil, fmt.Errorf("release asset is not supported for host: %s", infos[0])
+	}
+
+	var tag string
+	switch {
+	case n.Type == TAG:
+		tag = n.Value
+	case len(n.Value) > 0:
+		return nil, fmt.Errorf("release asset can only be fetched by tag, but got %s:%s", n.Type, n.Value)
+	}
+
+	req, err := http.NewRequestWithContext(interruptCtx, "GET", apiURL(infos[1], tag), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := n.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fail to make request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("fail to get release(%s): %s", n.VerString(), resp.Status)
+	}
+
+	var release struct {
+		TagName string          `json:"tag_name"`
+		Assets  []*ReleaseAsset `json:"assets"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("fail to decode response JSON: %v", err)
+	}
+	names := make([]string, 0, len(release.Assets))
+	for _, asset := range release.Assets {
+		if ok, _ := path.Match(pattern, asset.Name); ok {
+			log.Info("Found asset of release %s: %s", release.TagName, asset.Name)
+			return asset, nil
+		}
+		names = append(names, asset.Name)
+	}
+	return nil, fmt.Errorf("no asset of release %s matches %s, available: %s",
+		release.TagName, pattern, strings.Join(names, ", "))
+}
+
+// DownloadAsset downloads release asset into given directory as executable,
+// and returns path of saved file.
+func (n *Node) DownloadAsset(asset *ReleaseAsset, binDir string) (string, error) {
+	name := path.Base(asset.Name)
+	tmpPath := path.Join(setting.HomeDir, ".gopm/temp/asset", n.RootPath, name)
+	if setting.Debug {
+		log.Debug("Asset URL: %s", redactURL(asset.URL))
+		log.Debug("Temp asset path: %s", tmpPath)
+	}
+	if _, _, err := downloadArchive(n.httpClient(), asset.URL, tmpPath, asset.Size, n.addAttempt, nil); err != nil {
+		return "", err
+	}
+	n.ArchiveURL, n.ArchiveSize = redactURL(asset.URL), asset.Size
+
+	os.MkdirAll(binDir, os.ModePerm)
+	binPath := path.Join(binDir, name)
+	os.Remove(binPath)
+	// Bin directory may be on another device.
+	if err := os.Rename(tmpPath, binPath); err != nil {
+		if err = base.Copy(tmpPath, binPath); err != nil {
+			return "", fmt.Errorf("fail to move asset: %v", err)
+		}
+		os.Remove(tmpPath)
+	}
+	return binPath, os.Chmod(binPath, 0755)
+}
@@ -15,19 +15,38 @@
 package doc
 
 import (
+	"archive/tar"
+	stdzip "archive/zip"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/cae/tz"
 	"github.com/gpmgo/gopm/modules/cae/zip"
 	"github.com/gpmgo/gopm/modules/cli"
 	"github.com/gpmgo/gopm/modules/log"
@@ -73,10 +92,18 @@ type Pkg struct {
 	RootPath   string // Package root path on VCS.
 	Type       RevisionType
 	Value      string
+	Checksum   string // Expected SHA256 checksum of archive, empty for no check.
+	Size       int64  // Expected size of archive in bytes, zero for no check.
+	Revision   string // Revision that package has been fetched at.
 }
 
 func NewPkg(importPath string, tp RevisionType, val string) *Pkg {
-	return &Pkg{importPath, GetRootPath(importPath), tp, val}
+	return &Pkg{
+		ImportPath: importPath,
+		RootPath:   GetRootPath(importPath),
+		Type:       tp,
+		Value:      val,
+	}
 }
 
 func NewDefaultPkg(importPath string) *Pkg {
@@ -103,6 +130,14 @@ func (pkg *Pkg) ValSuffix() string {
 	return ""
 }
 
+// IsImportableSuffix returns true if directory with version suffix is still
+// a valid import path, so it can be used in GOPATH as is. Value with '/' makes
+// nested directories that cannot be told from subpackages.
+func (pkg *Pkg) IsImportableSuffix() bool {
+	return len(pkg.Value) == 0 || (!strings.ContainsAny(pkg.Value, "/\\") &&
+		base.IsValidRemotePath(pkg.RootPath+pkg.ValSuffix()))
+}
+
 func (pkg *Pkg) VerSuffix() string {
 	if len(pkg.Value) > 0 {
 		return " @ " + string(pkg.Type) + ":" + pkg.Value
@@ -117,9 +152,30 @@ type Node struct {
 	InstallPath   string // Local install path.
 	InstallGopath string
 	Synopsis      string
-	IsGetDeps     bool // False for downloading package itself only.
-	IsGetDepsOnly bool // True for skiping download package itself.
-	Revision      string
+	IsGetDeps     bool       // False for downloading package itself only.
+	IsGetDepsOnly bool       // True for skiping download package itself.
+	ArchiveURL    string     // URL of archive downloaded from gopm registry.
+	ArchiveSize   int64      // Size of downloaded archive in bytes.
+	ArchivePath   string     // Local path of archive kept after extraction.
+	Mirror        string     // Base URL of registry mirror that served the archive.
+	Depth         int        // Depth in dependency tree, 0 for root package.
+	IsExtracted   bool       // True if archive has been extracted in this run.
+	IsNotModified bool       // True if server tells archive has not changed since last download.
+	IsUnchanged   bool       // True if installed package comes from the same archive.
+	Vcs           string     // Version control tool declared by go-import meta tag.
+	RepoURL       string     // Repository URL declared by go-import meta tag.
+	Attempts      []*Attempt // Attempts to download archive in this run.
+
+	// HTTP client to fetch package with, nil for default one.
+	Client *http.Client
+}
+
+// httpClient returns HTTP client to fetch package with.
+func (n *Node) httpClient() *http.Client {
+	if n.Client != nil {
+		return n.Client
+	}
+	return HttpClient
 }
 
 // NewNode initializes and returns a new Node representation.
@@ -138,16 +194,36 @@ func NewNode(
 		DownloadURL: importPath,
 		IsGetDeps:   isGetDeps,
 	}
-	n.InstallPath = path.Join(setting.InstallRepoPath, n.RootPath) + n.ValSuffix()
-	n.InstallGopath = path.Join(setting.InstallGopath, n.RootPath)
+	n.setInstallPath()
 	return n
 }
 
-// IsExist returns true if package exists in local repository.
+// setInstallPath sets install paths by root path and version of package,
+// all versions share the plain import path in GOPATH for flat layout.
+func (n *Node) setInstallPath() {
+	n.InstallPath = joinFilePath(setting.InstallRepoPath, n.RootPath) + n.ValSuffix()
+	n.InstallGopath = joinFilePath(setting.InstallGopath, n.RootPath)
+	if setting.FlatLayout {
+		n.InstallPath = n.InstallGopath
+	}
+}
+
+// IsExist returns true if package exists in local repository,
+// or exists in GOPATH with the same version for flat layout.
 func (n *Node) IsExist() bool {
+	if setting.FlatLayout {
+		return base.IsExist(n.InstallPath) &&
+			setting.LocalNodes.MustValue(n.RootPath, "flat") == n.FlatVersion()
+	}
 	return base.IsExist(n.InstallPath)
 }
 
+// FlatVersion returns record of package installed in flat layout,
+// because directory name says nothing about version.
+func (n *Node) FlatVersion() string {
+	return n.InstallPath + "@" + string(n.Type) + ":" + n.Value
+}
+
 // IsExistGopath returns true if package exists in GOPATH.
 func (n *Node) IsExistGopath() bool {
 	return base.IsExist(n.InstallGopath)
@@ -168,13 +244,47 @@ func (n *Node) HasVcs() bool {
 	return len(GetVcsName(n.InstallGopath)) > 0
 }
 
+// lock acquires lock of given action on package, so that gopm processes
+// sharing local repository or GOPATH do not clobber each other.
+// The waited is set to true if it had to wait for other process.
+func (n *Node) lock(action string, waited *bool) (func(), error) {
+	name, suffix := n.RootPath+n.ValSuffix(), action
+	// Every version is copied to the same directory in GOPATH,
+	// which is also where archive is extracted for flat layout.
+	if action == "copy" || setting.FlatLayout {
+		name, suffix = n.RootPath, "copy"
+	}
+	lockPath := path.Join(setting.InstallRepoPath, ".lock", name+"."+suffix)
+	unlock, err := base.LockFile(lockPath, func() {
+		log.Warn("Waiting for other process to %s package: %s", action, n.VerString())
+		if waited != nil {
+			*waited = true
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fail to lock package(%s): %v", n.VerString(), err)
+	}
+	return unlock, nil
+}
+
 func (n *Node) CopyToGopath() error {
 	if n.HasVcs() {
 		log.Warn("Package in GOPATH has version control: %s", n.RootPath)
 		return nil
 	}
 
-	os.RemoveAll(n.InstallGopath)
+	unlock, err := n.lock("copy", nil)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := checkFreeSpace(n.InstallGopath, base.DirSize(n.InstallPath)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(n.InstallGopath); err != nil {
+		return fmt.Errorf("Fail to remove old package in GOPATH: %v", err)
+	}
 	if err := base.CopyDir(n.InstallPath, n.InstallGopath); err != nil {
 		if setting.LibraryMode {
 			return fmt.Errorf("Fail to copy to GOPATH: %v", err)
@@ -222,6 +332,14 @@ func (n *Node) UpdateByVcs(vcs string) error {
 			log.Error("", "\t"+stderr)
 			return errors.New(stderr)
 		}
+	case "bzr":
+		_, stderr, err := base.ExecCmdDir(n.InstallGopath,
+			"bzr", "pull")
+		if err != nil {
+			log.Error("", "Error occurs when 'bzr pull'")
+			log.Error("", "\t"+stderr)
+			return errors.New(stderr)
+		}
 	case "svn":
 		_, stderr, err := base.ExecCmdDir(n.InstallGopath,
 			"svn", "update")
@@ -234,6 +352,111 @@ func (n *Node) UpdateByVcs(vcs string) error {
 	return nil
 }
 
+// vcsByHost returns the version control tool that hosts given import path.
+func vcsByHost(importPath string) string {
+	switch {
+	case strings.HasPrefix(importPath, "bitbucket.org/"):
+		return "hg"
+	case strings.HasPrefix(importPath, "launchpad.net/"):
+		return "bzr"
+	}
+	return "git"
+}
+
+// CloneByVcs uses version control tool to fetch package into GOPATH,
+// only the history of given revision is fetched when it's possible.
+func (n *Node) CloneByVcs() error {
+	vcs := n.Vcs
+	if len(vcs) == 0 {
+		vcs = vcsByHost(n.RootPath)
+	}
+	repoURL := n.RepoURL
+	if len(repoURL) == 0 {
+		repoURL = "https://" + n.RootPath
+	} else if err := validRepoURL(repoURL); err != nil {
+		return fmt.Errorf("invalid repository URL(%s) of package(%s): %v", repoURL, n.RootPath, err)
+	}
+	switch vcs {
+	case "git", "hg", "bzr":
+	default:
+		return fmt.Errorf("version control tool(%s) of package(%s) is not supported", vcs, n.RootPath)
+	}
+	if _, err := exec.LookPath(vcs); err != nil {
+		return fmt.Errorf("%s is required for package(%s) but not found in PATH", vcs, n.RootPath)
+	}
+	// Value would be taken as an option otherwise.
+	if strings.HasPrefix(n.Value, "-") {
+		return fmt.Errorf("invalid version(%s) of package(%s): cannot start with '-'", n.Value, n.RootPath)
+	}
+
+	// Existed directory has no version control, replace it.
+	if err := os.RemoveAll(n.InstallGopath); err != nil {
+		return err
+	}
+	os.MkdirAll(path.Dir(n.InstallGopath), os.ModePerm)
+
+	var args []string
+	switch vcs {
+	case "hg":
+		args = []string{"clone"}
+		if len(n.Value) > 0 {
+			args = append(args, "--rev="+n.Value)
+		}
+		args = append(args, "--", repoURL, n.InstallGopath)
+	case "bzr":
+		args = []string{"branch"}
+		if len(n.Value) > 0 {
+			args = append(args, "--revision="+n.Value)
+		}
+		if len(n.RepoURL) == 0 {
+			repoURL = "lp:" + strings.TrimPrefix(n.RootPath, "launchpad.net/")
+		}
+		args = append(args, "--", repoURL, n.InstallGopath)
+	default:
+		args = []string{"clone"}
+		if n.Type != COMMIT {
+			args = append(args, "--depth", "1")
+			if len(n.Value) > 0 {
+				args = append(args, "--branch="+n.Value)
+			}
+		}
+		args = append(args, "--", repoURL, n.InstallGopath)
+	}
+	if _, stderr, err := base.ExecCmd(vcs, args...); err != nil {
+		return fmt.Errorf("%s %s: %v - %s", vcs, args[0], err, stderr)
+	}
+
+	if vcs == "git" && n.Type == COMMIT && len(n.Value) > 0 {
+		if _, stderr, err := base.ExecCmdDir(n.InstallGopath, "git", "checkout", n.Value, "--"); err != nil {
+			return fmt.Errorf("git checkout %s: %v - %s", n.Value, err, stderr)
+		}
+	}
+	return nil
+}
+
+// validRepoURL returns an error if given repository URL is not safe to be
+// passed to version control tool, which may take it as an option,
+// or clone through transport like 'ext::' which runs arbitrary command.
+func validRepoURL(repoURL string) error {
+	if strings.HasPrefix(repoURL, "-") {
+		return fmt.Errorf("URL cannot start with '-'")
+	}
+	i := strings.Index(repoURL, "://")
+	if i < 0 {
+		return fmt.Errorf("URL has no scheme")
+	}
+	switch scheme := repoURL[:i]; scheme {
+	case "https", "ssh", "git+ssh":
+	case "http":
+		if !IsInsecure {
+			return fmt.Errorf("scheme http is only allowed with --insecure")
+		}
+	default:
+		return fmt.Errorf("scheme %s is not allowed", scheme)
+	}
+	return nil
+}
+
 func attrValue(attrs []xml.Attr, name string) string {
 	for _, a := range attrs {
 		if strings.EqualFold(a.Name.Local, name) {
@@ -286,6 +509,9 @@ metaScan:
 			}
 			proto := repo[:i]
 			repo = repo[i+len("://"):]
+			if err := validRepoURL(f[2]); err != nil {
+				return nil, fmt.Errorf("bad repo URL in <meta>: %v", err)
+			}
 
 			match = map[string]string{
 				// Used in getVCSPkg, same as vcsPattern matches.
@@ -293,6 +519,7 @@ metaScan:
 				"repo":       repo,
 				"vcs":        vcs,
 				"dir":        importPath[len(projectRoot):],
+				"repoURL":    f[2],
 
 				// Used in getVCSPkg
 				"scheme": proto,
@@ -324,6 +551,13 @@ func fetchMeta(client *http.Client, importPath string) (map[string]string, error
 		if err == nil {
 			resp.Body.Close()
 		}
+		// Plain HTTP is only allowed in insecure mode.
+		if !IsInsecure {
+			if err == nil {
+				err = fmt.Errorf("%s", resp.Status)
+			}
+			return nil, fmt.Errorf("fail to make request(%s): %v", strings.SplitN(importPath, "/", 2)[0], err)
+		}
 		scheme = "http"
 		resp, err = client.Get(scheme + "://" + uri)
 		if err != nil {
@@ -354,6 +588,116 @@ func (n *Node) getDynamic(client *http.Client, ctx *cli.Context) ([]string, erro
 	return n.Download(ctx)
 }
 
+// metaRoots caches go-import meta tags by project root, failed lookups
+// are cached by import path with nil value. Lookups in flight are tracked
+// by host, so the same host is never asked twice at the same time.
+var metaRoots = struct {
+	sync.Mutex
+	m     map[string]map[string]string
+	calls map[string]chan struct{}
+}{
+	m:     make(map[string]map[string]string),
+	calls: make(map[string]chan struct{}),
+}
+
+// isKnownHost returns true if root path of given import path can be told
+// by host rules without asking the host.
+func isKnownHost(importPath string) bool {
+	if strings.HasPrefix(importPath, "gopkg.in/") {
+		return true
+	}
+	for prefix := range setting.RootPathPairs {
+		if strings.HasPrefix(importPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedMeta returns cached go-import meta tag that covers given import path,
+// it returns false if there is no record. Caller must hold lock of metaRoots.
+func cachedMeta(importPath string) (map[string]string, bool) {
+	for root, match := range metaRoots.m {
+		if match != nil && (importPath == root || strings.HasPrefix(importPath, root+"/")) {
+			return match, true
+		}
+	}
+	if match, ok := metaRoots.m[importPath]; ok && match == nil {
+		return nil, true
+	}
+	return nil, false
+}
+
+// lookupMeta returns go-import meta tag that covers given import path,
+// subpackages of a project share the tag fetched for the first one.
+func lookupMeta(client *http.Client, importPath string) (map[string]string, error) {
+	host := strings.SplitN(importPath, "/", 2)[0]
+
+	metaRoots.Lock()
+	for {
+		if match, ok := cachedMeta(importPath); ok {
+			metaRoots.Unlock()
+			if match == nil {
+				return nil, fmt.Errorf("<meta> not found")
+			}
+			return match, nil
+		}
+		call, ok := metaRoots.calls[host]
+		if !ok {
+			break
+		}
+		// Other lookup of same host may fetch what is needed.
+		metaRoots.Unlock()
+		<-call
+		metaRoots.Lock()
+	}
+	call := make(chan struct{})
+	metaRoots.calls[host] = call
+	metaRoots.Unlock()
+
+	// Network requests must not block lookups of other hosts.
+	match, err := fetchMeta(client, importPath)
+	if err == nil && match["projectRoot"] != importPath {
+		// Project root must declare itself, same as 'go get' does.
+		var rootMatch map[string]string
+		if rootMatch, err = fetchMeta(client, match["projectRoot"]); err == nil &&
+			rootMatch["projectRoot"] != match["projectRoot"] {
+			err = fmt.Errorf("project root mismatch: %s", match["projectRoot"])
+		}
+	}
+
+	metaRoots.Lock()
+	if err != nil {
+		metaRoots.m[importPath] = nil
+	} else {
+		metaRoots.m[match["projectRoot"]] = match
+	}
+	delete(metaRoots.calls, host)
+	metaRoots.Unlock()
+	close(call)
+	return match, err
+}
+
+// DiscoverRoot learns repository root and version control tool of vanity
+// import path from its go-import meta tag. Packages of known hosts are left
+// as they are, and so are packages without meta tag.
+func (n *Node) DiscoverRoot() error {
+	if len(n.RepoURL) > 0 || isKnownHost(n.ImportPath) {
+		return nil
+	}
+
+	match, err := lookupMeta(n.httpClient(), n.ImportPath)
+	if err != nil {
+		return err
+	}
+	n.Vcs, n.RepoURL = match["vcs"], match["repoURL"]
+	if n.RootPath != match["projectRoot"] {
+		n.RootPath = match["projectRoot"]
+		n.setInstallPath()
+	}
+	return nil
+}
+
 // Download downloads remote package without version control.
 func (n *Node) Download(ctx *cli.Context) ([]string, error) {
 	for _, s := range services {
@@ -375,7 +719,7 @@ func (n *Node) Download(ctx *cli.Context) ([]string, error) {
 				match[n] = m[i]
 			}
 		}
-		return s.get(HttpClient, match, n, ctx)
+		return s.get(n.httpClient(), match, n, ctx)
 
 	}
 
@@ -384,7 +728,7 @@ func (n *Node) Download(ctx *cli.Context) ([]string, error) {
 	}
 
 	log.Info("Cannot match any service, getting dynamic...")
-	return n.getDynamic(HttpClient, ctx)
+	return n.getDynamic(n.httpClient(), ctx)
 }
 
 type ApiError struct {
@@ -392,87 +736,1148 @@ type ApiError struct {
 }
 
 type ApiResponse struct {
-	Sha string `json:"sha"`
+	Sha      string `json:"sha"`
+	Size     int64  `json:"size"`     // Size of archive in bytes, optional.
+	Checksum string `json:"checksum"` // SHA256 checksum of archive, optional.
 }
 
 func init() {
 	zip.Verbose = false
+	zip.MaxWorkers = runtime.NumCPU()
 }
 
-// DownloadGopm downloads remote package from gopm registry.
-func (n *Node) DownloadGopm(ctx *cli.Context) error {
-	// Fetch latest version, check if package has been changed.
-	if n.Type == BRANCH && n.IsEmptyVal() {
-		resp, err := http.Get(fmt.Sprintf("%s%s?pkgname=%s",
-			setting.RegistryURL, setting.URL_API_REVISION, n.RootPath))
-		if err != nil {
-			return fmt.Errorf("fail to make request: %v", err)
+// mirrorURL returns URL of package archive in given registry mirror.
+// Local mirror like 'file:///media/usb/archive' is a directory of archives
+// named as gopm keeps them, i.e. 'github.com/Unknwon/com-v1.0.0.zip'.
+func (n *Node) mirrorURL(baseURL string) string {
+	if strings.HasPrefix(baseURL, "file://") {
+		name := n.Value
+		if len(name) == 0 {
+			name = n.Revision
 		}
-		if resp.StatusCode != 200 {
-			var apiErr ApiError
-			if err = json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
-				return fmt.Errorf("fail to decode response JSON: %v", err)
-			}
-			return errors.New(apiErr.Error)
-		}
-		var apiResp ApiResponse
-		if err = json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-			return fmt.Errorf("fail to decode response JSON: %v", err)
-		}
-		if n.Revision == apiResp.Sha {
-			log.Info("Package(%s) hasn't been changed", n.RootPath)
-			return nil
+		return fmt.Sprintf("%s/%s-%s.zip", baseURL, n.RootPath, name)
+	}
+	return fmt.Sprintf("%s%s?pkgname=%s&revision=%s",
+		baseURL, setting.URL_API_DOWNLOAD, n.RootPath, n.Value)
+}
+
+// templateURL returns URL of package archive built by template configured
+// for host of the package, or empty string if there is no such template.
+func (n *Node) templateURL() string {
+	host := strings.SplitN(n.RootPath, "/", 2)[0]
+	tpl, ok := setting.URLTemplates[host]
+	if !ok {
+		return ""
+	}
+	verid := n.Revision
+	if len(verid) == 0 {
+		verid = n.Value
+	}
+	return strings.NewReplacer("{name}", n.RootPath, "{ver}", n.Value, "{verid}", verid).Replace(tpl)
+}
+
+// archiveURLs returns URLs of package archive in the order to be tried,
+// URL template of package host comes before registry and its mirrors.
+func (n *Node) archiveURLs() []string {
+	urls := make([]string, 0, len(setting.Mirrors)+2)
+	if tplURL := n.templateURL(); len(tplURL) > 0 {
+		urls = append(urls, tplURL)
+	}
+	for _, baseURL := range setting.RegistryURLs() {
+		urls = append(urls, n.mirrorURL(baseURL))
+	}
+	return urls
+}
+
+// RegistryURL returns URL of package archive to try first.
+func (n *Node) RegistryURL() string {
+	return redactURL(n.archiveURLs()[0])
+}
+
+// LatestRevision returns information of latest revision of package from gopm registry,
+// registry mirrors are tried in turn when one is not reachable.
+func (n *Node) LatestRevision() (*ApiResponse, error) {
+	apiResp := new(ApiResponse)
+	if val, ok := getMetadata(n.RootPath, "revision"); ok &&
+		json.Unmarshal([]byte(val), apiResp) == nil {
+		return apiResp, nil
+	}
+
+	var err error
+	for _, baseURL := range setting.RegistryURLs() {
+		var retry bool
+		if retry, err = fetchRevision(n.httpClient(), baseURL, n.RootPath, apiResp); err == nil {
+			break
+		} else if !retry {
+			return nil, err
 		}
-		n.Revision = apiResp.Sha
+		log.Warn("Fail to get revision from %s: %v", redactURL(baseURL), err)
 	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(apiResp); err == nil {
+		setMetadata(n.RootPath, "revision", string(data))
+	}
+	return apiResp, nil
+}
 
-	resp, err := http.Get(fmt.Sprintf("%s%s?pkgname=%s&revision=%s",
-		setting.RegistryURL, setting.URL_API_DOWNLOAD, n.RootPath, n.Value))
+// fetchRevision gets revision information of package from given registry,
+// and reports whether the failure is worth trying another one.
+func fetchRevision(client *http.Client, baseURL, rootPath string, apiResp *ApiResponse) (bool, error) {
+	req, err := http.NewRequestWithContext(interruptCtx, "GET", fmt.Sprintf("%s%s?pkgname=%s",
+		baseURL, setting.URL_API_REVISION, rootPath), nil)
 	if err != nil {
-		return fmt.Errorf("fail to make request: %v", err)
+		return false, err
 	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if IsInterrupted() {
+			return false, errInterrupted
+		}
+		return true, fmt.Errorf("fail to make request: %v", err)
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		var apiErr ApiError
 		if err = json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
-			return fmt.Errorf("fail to decode response JSON: %v", err)
+			return true, fmt.Errorf("fail to decode response JSON: %v", err)
 		}
-		return errors.New(apiErr.Error)
+		return resp.StatusCode >= 500, errors.New(apiErr.Error)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(apiResp); err != nil {
+		return true, fmt.Errorf("fail to decode response JSON: %v", err)
+	}
+	return false, nil
+}
+
+// verifyArchive checks size and checksum of downloaded archive.
+func (n *Node) verifyArchive(localPath, sum string) error {
+	if fi, err := os.Stat(localPath); err == nil {
+		n.ArchiveSize = fi.Size()
+	}
+	if n.Size > 0 && n.ArchiveSize != n.Size {
+		return fmt.Errorf("size mismatch: expect %d bytes but got %d", n.Size, n.ArchiveSize)
+	}
+	if len(n.Checksum) > 0 && sum != strings.ToLower(n.Checksum) {
+		return fmt.Errorf("checksum mismatch: expect %s but got %s", n.Checksum, sum)
+	}
+	return nil
+}
+
+// downloadFromMirrors tries each registry mirror in turn until one of them
+// serves a valid archive, and returns file name of archive told by server
+// along with its SHA256 checksum. The cache is updated with validators
+// sent by that one.
+func (n *Node) downloadFromMirrors(localPath string, cache *archiveCache) (string, string, error) {
+	n.Attempts = nil
+	urls := n.archiveURLs()
+	for i, archiveURL := range urls {
+		n.ArchiveURL = redactURL(archiveURL)
+		if setting.Debug {
+			log.Debug("Archive URL: %s", n.ArchiveURL)
+		}
+		sum, fileName, err := downloadArchive(n.httpClient(), archiveURL, localPath, n.Size, n.addAttempt, cache)
+		if err == nil {
+			if err = n.verifyArchive(localPath, sum); err != nil {
+				os.Remove(localPath)
+				// Archive is downloaded but it is not the expected one.
+				last := n.Attempts[len(n.Attempts)-1]
+				last.Status, last.Error = "invalid", err.Error()
+			}
+		}
+		if err == nil {
+			if u, err := url.Parse(n.ArchiveURL); err == nil && len(u.Scheme) > 0 {
+				n.Mirror = u.Scheme + "://" + u.Host
+			}
+			if len(n.Attempts) > 1 {
+				log.Warn("Downloaded %s after %d attempts, from %s", n.VerString(), len(n.Attempts), n.ArchiveURL)
+			}
+			// Validators only make sense to the server that sent them.
+			if cache != nil && cache.URL != n.ArchiveURL {
+				*cache = archiveCache{URL: n.ArchiveURL}
+			}
+			return fileName, sum, nil
+		} else if IsInterrupted() || i == len(urls)-1 {
+			n.logAttempts()
+			return "", "", err
+		}
+
+		// Partial file from another mirror is not trusted.
+		log.Warn("Fail to download from %s: %v, try next mirror", n.ArchiveURL, err)
+		os.Remove(localPath)
+	}
+	return "", "", nil
+}
+
+// archiveStore returns directory of archives named by their SHA256 checksums,
+// so identical archives of different packages or versions are stored once.
+func archiveStore() string {
+	return path.Join(setting.HomeDir, ".gopm/temp/archive/sha256")
+}
+
+// findStoredArchive returns path of stored archive with given checksum,
+// or empty string if there is no such one.
+func findStoredArchive(sum string) string {
+	if len(sum) == 0 {
+		return ""
+	}
+	sum = strings.ToLower(sum)
+	matches, _ := filepath.Glob(path.Join(archiveStore(), sum+".*"))
+	if len(matches) == 0 {
+		return ""
+	}
+	// Stored archive is not trusted by its name only.
+	storePath := filepath.ToSlash(matches[0])
+	if actual, err := FileChecksum(storePath); err != nil || actual != sum {
+		log.Warn("Removed stored archive with wrong checksum: %s", storePath)
+		os.Remove(storePath)
+		return ""
+	}
+	return storePath
+}
+
+// CHECKSUM_FILE is name of file in package directory that keeps
+// SHA256 checksum of archive it is extracted from, and patterns
+// of files excluded when extracting if any.
+const CHECKSUM_FILE = ".gopmsum"
+
+// checksumRecord returns content of checksum file for archive of given
+// checksum, which is extracted with current exclude patterns.
+func checksumRecord(sum string) string {
+	if len(setting.Excludes) == 0 {
+		return sum
 	}
+	excludes := append([]string{}, setting.Excludes...)
+	sort.Strings(excludes)
+	return sum + "\nexclude " + strings.Join(excludes, ",")
+}
+
+// installedChecksum returns checksum record of archive that installed package
+// is extracted from, or empty string if it is unknown.
+func installedChecksum(installPath string) string {
+	data, err := ioutil.ReadFile(path.Join(installPath, CHECKSUM_FILE))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// archiveCache represents validators of archive from last download, which are
+// kept in a sidecar file next to archive, so server can tell whether it has changed.
+type archiveCache struct {
+	URL           string `json:"url"`
+	ETag          string `json:"etag,omitempty"`
+	LastModified  string `json:"last_modified,omitempty"`
+	Name          string `json:"name"`     // File name of archive told by server.
+	Checksum      string `json:"checksum"` // SHA256 checksum to find stored archive.
+	IsNotModified bool   `json:"-"`        // True if server responds 304 in this run.
+}
 
-	tmpPath := path.Join(setting.HomeDir, ".gopm/temp/archive",
-		n.RootPath+"-"+base.ToStr(time.Now().Nanosecond())+".zip")
-	defer os.Remove(tmpPath)
+// loadArchiveCache returns validators saved in given sidecar file,
+// it returns an empty one if there is no such file or it is broken.
+func loadArchiveCache(cachePath string) *archiveCache {
+	cache := new(archiveCache)
+	data, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		return cache
+	}
+	if err = json.Unmarshal(data, cache); err != nil {
+		log.Warn("Fail to load archive cache(%s): %v", cachePath, err)
+		return new(archiveCache)
+	}
+	return cache
+}
+
+// save writes validators into given sidecar file,
+// or removes it when server sent none of them.
+func (c *archiveCache) save(cachePath string) error {
+	if len(c.ETag) == 0 && len(c.LastModified) == 0 {
+		os.Remove(cachePath)
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cachePath, data, 0644)
+}
+
+// FileChecksum returns SHA256 checksum of given file.
+func FileChecksum(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// storeArchive moves archive into archive store and links it back to
+// original path, it returns path where archive can be found afterwards.
+func storeArchive(archivePath, sum string) (string, error) {
+	ext := tz.Format(archivePath)
+	if len(ext) == 0 {
+		ext = path.Ext(archivePath)
+	}
+	storePath := path.Join(archiveStore(), sum+ext)
+	os.MkdirAll(archiveStore(), os.ModePerm)
+	if base.IsFile(storePath) {
+		os.Remove(archivePath)
+	} else if err := os.Rename(archivePath, storePath); err != nil {
+		return "", err
+	}
+	// File system may not support symbolic link, i.e. Windows without privilege.
+	if err := os.Symlink(storePath, archivePath); err != nil {
+		return storePath, nil
+	}
+	return archivePath, nil
+}
+
+// setRevision sets latest revision of package along with size and checksum
+// of its archive from given response of gopm registry.
+func (n *Node) setRevision(apiResp *ApiResponse) {
+	n.Revision = apiResp.Sha
+	// Metadata from registry is only used when user does not give one.
+	if len(n.Checksum) == 0 {
+		n.Checksum = apiResp.Checksum
+	}
+	if n.Size == 0 {
+		n.Size = apiResp.Size
+	}
+}
+
+// tempArchivePath returns path of archive downloaded for given version
+// or revision of package, with given extension.
+func tempArchivePath(rootPath, name, ext string) string {
+	return path.Join(setting.HomeDir, ".gopm/temp/archive", rootPath+"-"+name+ext)
+}
+
+// TempArchivePaths returns all paths that archive downloaded for given
+// version or revision of package may be kept at, and its cache file.
+func TempArchivePaths(rootPath, name string) []string {
+	paths := []string{tempArchivePath(rootPath, name, ".zip"), tempArchivePath(rootPath, name, ".cache")}
+	for _, format := range tz.Formats() {
+		paths = append(paths, tempArchivePath(rootPath, name, format))
+	}
+	return paths
+}
+
+// fetchPackageArchive downloads archive of package into gopm temporary directory,
+// or reuses an identical stored one. It returns path and SHA256 checksum of archive,
+// along with format extension if it is a tarball.
+func (n *Node) fetchPackageArchive(ctx *cli.Context) (tmpPath, format, sum string, err error) {
+	// Use a stable archive path so an interrupted download can be resumed.
+	name := n.Value
+	if len(name) == 0 {
+		name = n.Revision
+	}
+	if len(name) == 0 {
+		name = base.ToStr(time.Now().Nanosecond())
+	}
+	tmpPath = tempArchivePath(n.RootPath, name, ".zip")
 	if setting.Debug {
 		log.Debug("Temp archive path: %s", tmpPath)
 	}
+	// Force update should never reuse any partial archive,
+	// and stored archive must never be written through its link.
+	if fi, err := os.Lstat(tmpPath); ctx.Bool("update") ||
+		(err == nil && fi.Mode()&os.ModeSymlink != 0) {
+		os.Remove(tmpPath)
+	}
 
+	// Identical archive may have been stored for another package or version.
+	var fileName string
 	os.MkdirAll(path.Dir(tmpPath), os.ModePerm)
-	fw, err := os.Create(tmpPath)
+	if stored := findStoredArchive(n.Checksum); len(stored) > 0 && !ctx.Bool("update") &&
+		os.Symlink(stored, tmpPath) == nil {
+		log.Info("Use stored archive: %s", stored)
+		fileName, sum = path.Base(stored), strings.ToLower(n.Checksum)
+		if fi, err := os.Stat(stored); err == nil {
+			n.ArchiveSize = fi.Size()
+		}
+	} else {
+		// Server is asked whether archive has changed since last download,
+		// which saves downloading it again for update.
+		cachePath := tempArchivePath(n.RootPath, name, ".cache")
+		cache := loadArchiveCache(cachePath)
+		if fileName, sum, err = n.downloadFromMirrors(tmpPath, cache); err != nil {
+			// Archive is verified before extracting anything.
+			return "", "", "", err
+		}
+		n.IsNotModified = cache.IsNotModified
+		if !n.IsNotModified {
+			cache.Name, cache.Checksum = fileName, sum
+			if err = cache.save(cachePath); err != nil {
+				log.Warn("Fail to save archive cache(%s): %v", cachePath, err)
+			}
+		}
+	}
+
+	// Mirrors may serve tarballs instead of zip, which is told by file name.
+	format = tz.Format(fileName)
+	if len(format) > 0 {
+		archivePath := tempArchivePath(n.RootPath, name, format)
+		if err = os.Rename(tmpPath, archivePath); err != nil {
+			os.Remove(tmpPath)
+			return "", "", "", fmt.Errorf("fail to rename archive: %v", err)
+		}
+		tmpPath = archivePath
+	} else if ext := path.Ext(fileName); len(ext) > 0 && ext != ".zip" {
+		os.Remove(tmpPath)
+		return "", "", "", fmt.Errorf("unsupported archive format: %s", fileName)
+	}
+	// Checksum of archive is recorded in lock file.
+	n.Checksum = sum
+	return tmpPath, format, sum, nil
+}
+
+// saveArchive keeps downloaded archive unless user does not want it.
+func (n *Node) saveArchive(tmpPath, sum string) error {
+	if setting.NoCache {
+		return os.Remove(tmpPath)
+	}
+	var err error
+	if n.ArchivePath, err = storeArchive(tmpPath, sum); err != nil {
+		return fmt.Errorf("fail to store archive: %v", err)
+	}
+	log.Info("Archive kept at %s", n.ArchivePath)
+	return nil
+}
+
+// ArchiveEntry represents a file in package archive.
+type ArchiveEntry struct {
+	Name string
+	Size int64
+}
+
+// ListArchive downloads archive of package and returns files in it
+// without installing anything, so contents served by mirror can be verified.
+func (n *Node) ListArchive(ctx *cli.Context) ([]*ArchiveEntry, error) {
+	if n.Type == BRANCH && n.IsEmptyVal() {
+		apiResp, err := n.LatestRevision()
+		if err != nil {
+			return nil, err
+		}
+		n.setRevision(apiResp)
+	}
+
+	unlock, err := n.lock("fetch", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tmpPath, format, sum, err := n.fetchPackageArchive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every entry is skipped by hook, so nothing is written.
+	entries := make([]*ArchiveEntry, 0, 10)
+	listFn := func(fullName string, fi os.FileInfo) error {
+		if !fi.IsDir() {
+			entries = append(entries, &ArchiveEntry{fullName, fi.Size()})
+		}
+		return errExcluded
+	}
+	listPath := tmpPath + ".list"
+	defer os.RemoveAll(listPath)
+	if len(format) > 0 {
+		err = tz.ExtractToFunc(tmpPath, listPath, listFn)
+	} else {
+		err = zip.ExtractToFunc(tmpPath, listPath, listFn)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("fail to read archive: %v", err)
+	}
+	return entries, n.saveArchive(tmpPath, sum)
+}
+
+// DownloadGopm downloads remote package from gopm registry.
+func (n *Node) DownloadGopm(ctx *cli.Context) error {
+	// Fetch latest version, check if package has been changed.
+	if n.Type == BRANCH && n.IsEmptyVal() {
+		apiResp, err := n.LatestRevision()
+		if err != nil {
+			return err
+		}
+		if n.Revision == apiResp.Sha && !ctx.Bool("update") {
+			log.Info("Package(%s) hasn't been changed", n.RootPath)
+			return nil
+		}
+		n.setRevision(apiResp)
+	}
+
+	// Other gopm process may be fetching the same package.
+	waited := false
+	unlock, err := n.lock("fetch", &waited)
 	if err != nil {
 		return err
 	}
-	if _, err = io.Copy(fw, resp.Body); err != nil {
-		return fmt.Errorf("fail to save archive: %v", err)
+	defer unlock()
+	if waited && n.IsFixed() && n.IsExist() && !ctx.Bool("update") && !ctx.Bool("frozen") {
+		log.Info("Package(%s) has been installed by other process", n.VerString())
+		return nil
 	}
-	fw.Close()
 
-	// Remove old files.
-	os.RemoveAll(n.InstallPath)
-	os.MkdirAll(path.Dir(n.InstallPath), os.ModePerm)
+	// Checksum is replaced by the one of downloaded archive,
+	// but download again has to be verified against what is expected.
+	expectSum := n.Checksum
+	tmpPath, format, sum, err := n.fetchPackageArchive(ctx)
+	if err != nil {
+		return err
+	}
+	// Archive is only kept when everything goes well.
+	keepArchive := false
+	defer func() {
+		if !keepArchive {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	// Nothing to extract when installed one comes from the same archive
+	// with the same files excluded, but frozen mode always extracts again
+	// in case files are modified.
+	if n.IsExist() && !ctx.Bool("frozen") && installedChecksum(n.InstallPath) == checksumRecord(sum) {
+		log.Info("Package(%s) is unchanged", n.VerString())
+		n.IsUnchanged = true
+		keepArchive = true
+		return n.saveArchive(tmpPath, sum)
+	}
+
+	// Fail early rather than leaving a partial tree when disk is full.
+	if err = checkFreeSpace(n.InstallPath, estimateExtractSize(tmpPath, format)); err != nil {
+		return err
+	}
 
+	// Extract into a sibling temporary directory first, so the package
+	// is either complete or absent even extraction is interrupted.
+	extractPath := n.InstallPath + ".tmp"
+	if setting.Debug {
+		log.Debug("Extract path: %s", extractPath)
+		log.Debug("Install path: %s", n.InstallPath)
+	}
+	if err = os.RemoveAll(extractPath); err != nil {
+		return fmt.Errorf("fail to remove old temporary directory: %v", err)
+	}
+	defer os.RemoveAll(extractPath)
+
+	// Archive usually wraps all contents in a single top-level directory,
+	// which has to be stripped, but flat archive does not have one.
 	var rootDir string
+	var isFlat bool
+	var numFiles, numGoFiles, numExcluded, numEntries int
+	var numBytes int64
+	var limitErr error
+	if setting.Debug {
+		log.Debug("Extract limits: %d bytes, %d entries", setting.MaxExtractSize, setting.MaxExtractFiles)
+	}
 	var extractFn = func(fullName string, fi os.FileInfo) error {
+		if IsInterrupted() {
+			return errInterrupted
+		}
+		// Stop archive bomb, entry size is checked by reader when extracting.
+		if limitErr != nil {
+			return limitErr
+		}
+		numEntries++
+		numBytes += fi.Size()
+		switch {
+		case setting.MaxExtractFiles > 0 && numEntries > setting.MaxExtractFiles:
+			limitErr = fmt.Errorf("archive has more than %d entries", setting.MaxExtractFiles)
+			return limitErr
+		case setting.MaxExtractSize > 0 && numBytes > setting.MaxExtractSize:
+			limitErr = fmt.Errorf("archive expands to more than %d bytes", setting.MaxExtractSize)
+			return limitErr
+		}
+		infos := strings.SplitN(fullName, "/", 2)
 		if len(rootDir) == 0 {
-			rootDir = strings.Split(fullName, "/")[0]
+			rootDir = infos[0]
+		}
+		if infos[0] != rootDir || (len(infos) == 1 && !fi.IsDir()) {
+			isFlat = true
+		}
+		// Match with and without top-level directory,
+		// because archive is not known as flat or not yet.
+		if len(setting.Excludes) > 0 && (IsExcluded(fullName, setting.Excludes) ||
+			(len(infos) == 2 && len(infos[1]) > 0 && IsExcluded(infos[1], setting.Excludes))) {
+			if !fi.IsDir() {
+				numExcluded++
+			}
+			log.Debug("Excluded file...%s", fullName)
+			return errExcluded
+		}
+		if !fi.IsDir() {
+			numFiles++
+			if strings.HasSuffix(fullName, ".go") {
+				numGoFiles++
+			}
+			log.Debug("Extracting file...%s", fullName)
 		}
 		return nil
 	}
 
-	if err := zip.ExtractToFunc(tmpPath, path.Dir(n.InstallPath), extractFn); err != nil {
+	extract := func() error {
+		rootDir, isFlat = "", false
+		numFiles, numGoFiles, numExcluded, numEntries = 0, 0, 0, 0
+		numBytes, limitErr = 0, nil
+		if len(format) > 0 {
+			return tz.ExtractToFunc(tmpPath, extractPath, extractFn)
+		}
+		return zip.ExtractToFunc(tmpPath, extractPath, extractFn)
+	}
+	err = extract()
+	// Archive resumed from a broken partial file can be corrupted,
+	// so download it again from scratch once before giving up.
+	if err != nil && isCorruptArchive(err) && !IsInterrupted() {
+		log.Warn("Archive of %s is corrupted: %v, download again", n.RootPath, err)
+		os.Remove(tmpPath)
+		if stored := findStoredArchive(sum); len(stored) > 0 {
+			os.Remove(stored)
+		}
+		os.RemoveAll(extractPath)
+		n.Checksum = expectSum
+		if _, sum, err = n.downloadFromMirrors(tmpPath, nil); err != nil {
+			return err
+		}
+		n.Checksum = sum
+		err = extract()
+	}
+	if err == nil {
+		err = limitErr
+	}
+	if err != nil {
 		return fmt.Errorf("fail to extract archive: %v", err)
-	} else if err = os.Rename(path.Join(path.Dir(n.InstallPath), rootDir),
-		n.InstallPath); err != nil {
+	}
+	if IsInterrupted() {
+		return errInterrupted
+	}
+
+	// Wrong archive may be served, which is not buildable at all.
+	if numGoFiles == 0 {
+		if ctx.GlobalBool("strict") {
+			return fmt.Errorf("no Go source file found in archive")
+		}
+		log.Warn("No Go source file found in package: %s", n.RootPath)
+	}
+
+	// Remove old files.
+	if err = os.RemoveAll(n.InstallPath); err != nil {
+		return fmt.Errorf("fail to remove old package: %v", err)
+	}
+	if !isFlat {
+		extractPath = path.Join(extractPath, rootDir)
+	}
+	// Checksum tells which archive the package comes from next time.
+	if err = ioutil.WriteFile(path.Join(extractPath, CHECKSUM_FILE), []byte(checksumRecord(sum)+"\n"), 0644); err != nil {
+		log.Warn("Fail to save checksum of %s: %v", n.VerString(), err)
+	}
+	if err = os.Rename(extractPath, n.InstallPath); err != nil {
 		return fmt.Errorf("fail to rename directory: %v", err)
 	}
+	log.Info("Extracted %d files(%d Go source files) into %s", numFiles, numGoFiles, n.InstallPath)
+	if numExcluded > 0 {
+		log.Info("Excluded %d files by patterns: %v", numExcluded, setting.Excludes)
+	}
+
+	keepArchive = true
+	n.IsExtracted = true
+	return n.saveArchive(tmpPath, sum)
+}
+
+var (
+	// interruptCtx is canceled when user interrupts,
+	// requests made with it are aborted at once.
+	interruptCtx, cancelInterrupt = context.WithCancel(context.Background())
+
+	errInterrupted = errors.New("interrupted by user")
+	errExcluded    = errors.New("excluded by pattern")
+)
+
+// Interrupt aborts all in-flight downloads and extractions.
+func Interrupt() {
+	cancelInterrupt()
+}
+
+// IsInterrupted returns true if user has interrupted the process.
+func IsInterrupted() bool {
+	return interruptCtx.Err() != nil
+}
+
+// Context returns context that is canceled when user interrupts the process,
+// which should be used by all network requests.
+func Context() context.Context {
+	return interruptCtx
+}
+
+// estimateExtractSize returns estimated bytes of archive after extraction,
+// it is exact for zip and plain tar, but only a lower bound for others.
+func estimateExtractSize(archivePath, format string) int64 {
+	fi, err := os.Stat(archivePath)
+	if err != nil {
+		return 0
+	}
+	switch format {
+	case "":
+		zr, err := stdzip.OpenReader(archivePath)
+		if err != nil {
+			return fi.Size()
+		}
+		defer zr.Close()
+		var size int64
+		for _, f := range zr.File {
+			size += int64(f.UncompressedSize64)
+		}
+		return size
+	case ".tar.gz", ".tgz":
+		// Last 4 bytes of gzip is uncompressed size modulo 2^32.
+		f, err := os.Open(archivePath)
+		if err != nil || fi.Size() < 4 {
+			return fi.Size()
+		}
+		defer f.Close()
+		buf := make([]byte, 4)
+		if _, err = f.ReadAt(buf, fi.Size()-4); err != nil {
+			return fi.Size()
+		}
+		if size := int64(binary.LittleEndian.Uint32(buf)); size > fi.Size() {
+			return size
+		}
+	}
+	return fi.Size()
+}
+
+// checkFreeSpace returns error if volume of given path does not have enough
+// free space for given bytes. It is best-effort, and skipped when free space is unknown.
+func checkFreeSpace(p string, need int64) error {
+	if setting.SkipDiskCheck || need <= 0 {
+		return nil
+	}
+	// Path may not exist yet, check its nearest existing parent.
+	for !base.IsExist(p) && path.Dir(p) != p {
+		p = path.Dir(p)
+	}
+	free, err := base.FreeSpace(p)
+	if err != nil {
+		if setting.Debug {
+			log.Debug("Skipped free space check of %s: %v", p, err)
+		}
+		return nil
+	}
+	if uint64(need) > free {
+		return fmt.Errorf("not enough disk space in %s: need %s but only %s available, use '--force' to skip check",
+			p, base.HumaneSize(need), base.HumaneSize(int64(free)))
+	}
 	return nil
 }
+
+// isCorruptArchive returns true if given error is caused by malformed archive.
+func isCorruptArchive(err error) bool {
+	var flateErr flate.CorruptInputError
+	var bzip2Err bzip2.StructuralError
+	return errors.Is(err, stdzip.ErrFormat) || errors.Is(err, stdzip.ErrChecksum) ||
+		errors.Is(err, stdzip.ErrAlgorithm) || errors.Is(err, gzip.ErrHeader) ||
+		errors.Is(err, gzip.ErrChecksum) || errors.Is(err, tar.ErrHeader) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &flateErr) || errors.As(err, &bzip2Err)
+}
+
+// downloadArchive downloads archive from given URL to local path and returns
+// its SHA256 checksum and file name told by server. It retries with exponential backoff on network errors
+// and server errors, and returns the last error when all attempts fail.
+// The size is expected size of archive, zero for no check.
+// The cache is validators of last download to make conditional request, nil for none.
+func downloadArchive(client *http.Client, url, localPath string, size int64, record func(*Attempt), cache *archiveCache) (sum, name string, err error) {
+	if record == nil {
+		record = func(*Attempt) {}
+	}
+	if srcPath, ok := localArchivePath(url); ok {
+		start := time.Now()
+		sum, name, err = copyArchive(srcPath, localPath, size)
+		record(newAttempt(url, start, err))
+		return sum, name, err
+	}
+
+	wait := time.Second
+	for i := 1; ; i++ {
+		var retry bool
+		start := time.Now()
+		sum, name, retry, err = fetchArchive(client, url, localPath, size, cache)
+		record(newAttempt(url, start, err))
+		if err == nil || !retry || i >= setting.MaxRetries {
+			return sum, name, err
+		}
+		log.Warn("Fail to download archive(%d/%d): %v, retry in %s", i, setting.MaxRetries, err, wait)
+		select {
+		case <-time.After(wait):
+		case <-interruptCtx.Done():
+			return "", "", errInterrupted
+		}
+		wait *= 2
+	}
+}
+
+// Attempt represents one attempt to download archive.
+type Attempt struct {
+	URL      string        `json:"url"`
+	Status   string        `json:"status"` // HTTP status or kind of failure, i.e. 'dns', 'tls' and 'timeout'.
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+func newAttempt(url string, start time.Time, err error) *Attempt {
+	a := &Attempt{URL: redactURL(url), Status: "ok", Duration: time.Since(start)}
+	if err != nil {
+		a.Status, a.Error = failureKind(err), err.Error()
+	}
+	return a
+}
+
+func (n *Node) addAttempt(a *Attempt) {
+	n.Attempts = append(n.Attempts, a)
+}
+
+// logAttempts prints every attempt to download archive of package,
+// so user can tell what went wrong with each mirror.
+func (n *Node) logAttempts() {
+	log.Error("Fail to download %s, attempts:", n.VerString())
+	for i, a := range n.Attempts {
+		log.Error("  %d. %s [%s] in %s: %s", i+1, a.URL, a.Status,
+			a.Duration.Round(time.Millisecond), a.Error)
+	}
+}
+
+// statusError represents unexpected HTTP status of response.
+type statusError struct {
+	status string
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// timeoutError represents that download stalled for too long.
+type timeoutError struct {
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("no data received in %s", e.timeout)
+}
+
+func (e *timeoutError) Timeout() bool {
+	return true
+}
+
+// failureKind returns what kind of failure given error is,
+// which is the HTTP status if server does respond.
+func failureKind(err error) string {
+	var (
+		statusErr *statusError
+		dnsErr    *net.DNSError
+		timeout   interface{ Timeout() bool }
+	)
+	msg := err.Error()
+	switch {
+	case err == errInterrupted:
+		return "interrupted"
+	case errors.As(err, &statusErr):
+		return statusErr.status
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case strings.Contains(msg, "x509: ") || strings.Contains(msg, "tls: "):
+		return "tls"
+	case errors.As(err, &timeout) && timeout.Timeout():
+		return "timeout"
+	case strings.Contains(msg, "connection refused"):
+		return "refused"
+	case strings.Contains(msg, "mismatch"):
+		return "invalid"
+	}
+	return "error"
+}
+
+// localArchivePath returns file system path of archive if given URL
+// has file scheme or is an existing local path, i.e. for air-gapped installs.
+func localArchivePath(rawURL string) (string, bool) {
+	if strings.HasPrefix(rawURL, "file://") {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return "", false
+		}
+		// File URL of Windows looks like 'file:///C:/path/to/archive.zip'.
+		if runtime.GOOS == "windows" {
+			return strings.TrimPrefix(u.Path, "/"), true
+		}
+		return u.Path, true
+	}
+	if !strings.Contains(rawURL, "://") && base.IsFile(rawURL) {
+		return rawURL, true
+	}
+	return "", false
+}
+
+// copyArchive copies local archive to given path, and returns its SHA256
+// checksum and file name. The size is expected size of archive, zero for no check.
+func copyArchive(srcPath, localPath string, size int64) (string, string, error) {
+	fr, err := os.Open(srcPath)
+	if err != nil {
+		return "", "", fmt.Errorf("fail to open local archive: %v", err)
+	}
+	defer fr.Close()
+	if fi, err := fr.Stat(); err != nil {
+		return "", "", err
+	} else if size > 0 && fi.Size() != size {
+		return "", "", fmt.Errorf("size mismatch: expect %d bytes but local archive has %d", size, fi.Size())
+	}
+	if setting.Debug {
+		log.Debug("Copy local archive: %s", srcPath)
+	}
+
+	os.MkdirAll(path.Dir(localPath), os.ModePerm)
+	fw, err := os.Create(localPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer fw.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(fw, h), fr); err != nil {
+		return "", "", fmt.Errorf("fail to copy local archive: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), path.Base(filepath.ToSlash(srcPath)), nil
+}
+
+// archiveName returns file name of archive that server tells by
+// Content-Disposition header or final URL after redirects.
+func archiveName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil &&
+		len(params["filename"]) > 0 {
+		return path.Base(params["filename"])
+	}
+	return path.Base(resp.Request.URL.Path)
+}
+
+// fetchArchive makes one attempt to download archive and reports whether
+// the failure is worth retrying. If a partial file from previous run exists,
+// it tries to resume from where it left off, and restarts when server does
+// not support it. The partial file is kept on failure so next run can continue.
+// When cache has validators from the same URL, server is asked whether archive
+// has changed, and stored archive is linked to local path if not.
+func fetchArchive(client *http.Client, url, localPath string, size int64, cache *archiveCache) (string, string, bool, error) {
+	var offset int64
+	if fi, err := os.Stat(localPath); err == nil {
+		offset = fi.Size()
+	}
+
+	req, err := http.NewRequestWithContext(interruptCtx, "GET", url, nil)
+	if err != nil {
+		return "", "", false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else if cache != nil && cache.URL == redactURL(url) {
+		if len(cache.ETag) > 0 {
+			req.Header.Set("If-None-Match", cache.ETag)
+		}
+		if len(cache.LastModified) > 0 {
+			req.Header.Set("If-Modified-Since", cache.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if IsInterrupted() {
+			return "", "", false, errInterrupted
+		}
+		return "", "", true, fmt.Errorf("fail to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	if setting.Debug {
+		log.Debug("Response of %s: %s, content length: %d", redactURL(resp.Request.URL.String()),
+			resp.Status, resp.ContentLength)
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch resp.StatusCode {
+	case http.StatusOK:
+		offset = 0
+	case http.StatusPartialContent:
+		flag = os.O_WRONLY | os.O_APPEND
+		log.Info("Resuming download from %d bytes", offset)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Partial file is broken or larger than remote one, start over.
+		os.Remove(localPath)
+		return fetchArchive(client, url, localPath, size, cache)
+	case http.StatusNotModified:
+		if cache == nil {
+			return "", "", false, &statusError{resp.Status,
+				fmt.Sprintf("fail to download archive(%s): unexpected %s", redactURL(url), resp.Status)}
+		}
+		if stored := findStoredArchive(cache.Checksum); len(stored) > 0 &&
+			os.Symlink(stored, localPath) == nil {
+			log.Info("Archive has not been modified, use stored one: %s", stored)
+			cache.IsNotModified = true
+			return cache.Checksum, cache.Name, false, nil
+		}
+		// Stored archive may have been cleaned up, then ask for it again.
+		return fetchArchive(client, url, localPath, size, nil)
+	default:
+		// Only server errors are temporary, others like 404 are not.
+		retry := resp.StatusCode >= 500
+		var apiErr ApiError
+		msg := fmt.Sprintf("fail to download archive(%s): %s", redactURL(url), resp.Status)
+		if err = json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && len(apiErr.Error) > 0 {
+			msg += " - " + apiErr.Error
+		}
+		return "", "", retry, &statusError{resp.Status, msg}
+	}
+
+	// Refuse archive of unexpected size before writing anything.
+	if size > 0 && resp.ContentLength > 0 && offset+resp.ContentLength != size {
+		os.Remove(localPath)
+		return "", "", false, fmt.Errorf("size mismatch: expect %d bytes but server sends %d",
+			size, offset+resp.ContentLength)
+	}
+
+	h := sha256.New()
+	if flag&os.O_APPEND != 0 {
+		// Previous bytes have to be part of checksum as well.
+		fr, err := os.Open(localPath)
+		if err != nil {
+			return "", "", false, err
+		}
+		_, err = io.Copy(h, fr)
+		fr.Close()
+		if err != nil {
+			return "", "", false, err
+		}
+	}
+
+	os.MkdirAll(path.Dir(localPath), os.ModePerm)
+	fw, err := os.OpenFile(localPath, flag, 0644)
+	if err != nil {
+		return "", "", false, err
+	}
+	defer fw.Close()
+
+	w := io.MultiWriter(fw, h)
+	if log.Verbose && !NoProgress {
+		pw := &progressWriter{written: offset}
+		if resp.ContentLength > 0 {
+			pw.total = offset + resp.ContentLength
+		}
+		defer pw.finish()
+		w = io.MultiWriter(w, pw)
+	}
+
+	r := newIdleTimeoutReader(resp.Body, setting.DownloadTimeout)
+	defer r.Stop()
+	if _, err = io.Copy(w, r); err != nil {
+		// Partial file is kept so next run can resume from it.
+		if IsInterrupted() {
+			return "", "", false, errInterrupted
+		} else if r.IsTimeout() {
+			err = &timeoutError{setting.DownloadTimeout}
+		}
+		return "", "", true, fmt.Errorf("fail to save archive: %w", err)
+	}
+	if cache != nil {
+		cache.URL, cache.IsNotModified = redactURL(url), false
+		cache.ETag, cache.LastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	}
+	return hex.EncodeToString(h.Sum(nil)), archiveName(resp), false, nil
+}
+
+// idleTimeoutReader closes underlying reader when no data
+// has been read for given duration, so that a stalled download
+// will not block forever, while a slow one can still finish.
+type idleTimeoutReader struct {
+	rc      io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	done    chan struct{}
+
+	lock      sync.Mutex
+	isTimeout bool
+}
+
+func newIdleTimeoutReader(rc io.ReadCloser, timeout time.Duration) *idleTimeoutReader {
+	r := &idleTimeoutReader{rc: rc, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.lock.Lock()
+		r.isTimeout = true
+		r.lock.Unlock()
+		r.rc.Close()
+	})
+
+	// Unblock reading as soon as user interrupts.
+	r.done = make(chan struct{})
+	go func() {
+		select {
+		case <-interruptCtx.Done():
+			r.rc.Close()
+		case <-r.done:
+		}
+	}()
+	return r
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.timer.Reset(r.timeout)
+	return n, err
+}
+
+// IsTimeout returns true if reader has been closed because of idle timeout.
+func (r *idleTimeoutReader) IsTimeout() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.isTimeout
+}
+
+func (r *idleTimeoutReader) Stop() {
+	r.timer.Stop()
+	close(r.done)
+}
+
+// NoProgress disables download progress, which is printed in place
+// and garbled when packages are downloaded at the same time.
+var NoProgress bool
+
+// progressWriter prints download progress in place, it only shows
+// transferred bytes when total size is unknown.
+type progressWriter struct {
+	total     int64
+	written   int64
+	lastPrint time.Time
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.written += int64(len(p))
+	if time.Since(pw.lastPrint) > 200*time.Millisecond {
+		pw.print()
+	}
+	return len(p), nil
+}
+
+func (pw *progressWriter) print() {
+	pw.lastPrint = time.Now()
+	if pw.total > 0 {
+		fmt.Fprintf(log.Output, "\rDownloading... %3d%% (%d/%d bytes)",
+			pw.written*100/pw.total, pw.written, pw.total)
+	} else {
+		fmt.Fprintf(log.Output, "\rDownloading... %d bytes", pw.written)
+	}
+}
+
+func (pw *progressWriter) finish() {
+	pw.print()
+	fmt.Fprintln(log.Output)
+}
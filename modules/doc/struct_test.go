@@ -0,0 +1,464 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gpmgo/gopm/modules/cli"
+	"github.com/gpmgo/gopm/modules/goconfig"
+	"github.com/gpmgo/gopm/modules/log"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+func init() {
+	log.Output = ioutil.Discard
+}
+
+// testRegistry serves revision and archive of any package as gopm registry does.
+type testRegistry struct {
+	*httptest.Server
+	lock     sync.Mutex
+	revision string
+	archive  []byte
+	status   int // Status code to fail archive downloads with, 0 for success.
+
+	ifNoneMatch string // Validator sent by last archive download.
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{status: http.StatusOK}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		switch req.URL.Path {
+		case setting.URL_API_REVISION:
+			json.NewEncoder(w).Encode(map[string]string{"sha": r.revision})
+		case setting.URL_API_DOWNLOAD:
+			if r.status != http.StatusOK {
+				w.WriteHeader(r.status)
+				w.Write([]byte("<html>not here</html>"))
+				return
+			}
+			etag := `"` + r.revision + `"`
+			r.ifNoneMatch = req.Header.Get("If-None-Match")
+			if r.ifNoneMatch == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write(r.archive)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// serve sets what registry serves from now on.
+func (r *testRegistry) serve(revision string, archive []byte, status int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.revision, r.archive, r.status = revision, archive, status
+}
+
+// newTestZip returns zip archive of given files keyed by name.
+func newTestZip(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, body := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// setupTestHome points gopm home and registry to temporary ones for a test.
+func setupTestHome(t *testing.T, registryURL string) {
+	homeDir, repoPath, mirrors := setting.HomeDir, setting.InstallRepoPath, setting.Mirrors
+	registry, retries, localNodes := setting.RegistryURL, setting.MaxRetries, setting.LocalNodes
+	t.Cleanup(func() {
+		setting.HomeDir, setting.InstallRepoPath, setting.Mirrors = homeDir, repoPath, mirrors
+		setting.RegistryURL, setting.MaxRetries, setting.LocalNodes = registry, retries, localNodes
+	})
+
+	setting.HomeDir = t.TempDir()
+	setting.InstallRepoPath = path.Join(setting.HomeDir, ".gopm/repos")
+	setting.Mirrors = nil
+	setting.RegistryURL = registryURL
+	setting.MaxRetries = 1
+	var err error
+	if setting.LocalNodes, err = goconfig.LoadFromData([]byte("")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestContext returns context of command get with given flags enabled.
+func newTestContext(flags ...string) *cli.Context {
+	set := flag.NewFlagSet("get", flag.ContinueOnError)
+	for _, name := range []string{"update", "frozen", "force"} {
+		set.Bool(name, false, "")
+	}
+	for _, name := range flags {
+		set.Set(name, "true")
+	}
+	globalSet := flag.NewFlagSet("gopm", flag.ContinueOnError)
+	globalSet.Bool("strict", false, "")
+	return cli.NewContext(nil, set, globalSet)
+}
+
+func TestDownloadGopmUpdate(t *testing.T) {
+	r := newTestRegistry(t)
+	setupTestHome(t, r.URL)
+
+	r.serve("r1", newTestZip(t, map[string]string{
+		"com-master/com.go": "package com",
+		"com-master/old.go": "package com",
+		"com-master/old/a":  "old",
+	}), http.StatusOK)
+	n := NewNode("github.com/Unknwon/com", BRANCH, "", false)
+	if err := n.DownloadGopm(newTestContext()); err != nil {
+		t.Fatal(err)
+	}
+	// User may have put something in it.
+	if err := ioutil.WriteFile(path.Join(n.InstallPath, "stale.go"), []byte("package com"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r.serve("r2", newTestZip(t, map[string]string{
+		"com-master/com.go": "package com // r2",
+	}), http.StatusOK)
+	n = NewNode("github.com/Unknwon/com", BRANCH, "", false)
+	if err := n.DownloadGopm(newTestContext("update")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"old.go", "old", "stale.go"} {
+		if _, err := os.Stat(path.Join(n.InstallPath, name)); !os.IsNotExist(err) {
+			t.Errorf("%s of old package is not removed by update: %v", name, err)
+		}
+	}
+	if data, err := ioutil.ReadFile(path.Join(n.InstallPath, "com.go")); err != nil {
+		t.Error(err)
+	} else if string(data) != "package com // r2" {
+		t.Errorf("com.go is not updated: %q", data)
+	}
+}
+
+func TestDownloadGopmUpdateNotModified(t *testing.T) {
+	r := newTestRegistry(t)
+	setupTestHome(t, r.URL)
+	r.serve("r1", newTestZip(t, map[string]string{
+		"com-master/com.go": "package com",
+	}), http.StatusOK)
+
+	n := NewNode("github.com/Unknwon/com", BRANCH, "", false)
+	if err := n.DownloadGopm(newTestContext("update")); err != nil {
+		t.Fatal(err)
+	}
+	if n.IsNotModified {
+		t.Error("expect first download not to be answered by 304")
+	}
+	// File is gone if package is extracted again.
+	mark := path.Join(n.InstallPath, "mark")
+	if err := ioutil.WriteFile(mark, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n = NewNode("github.com/Unknwon/com", BRANCH, "", false)
+	if err := n.DownloadGopm(newTestContext("update")); err != nil {
+		t.Fatal(err)
+	}
+	if r.ifNoneMatch != `"r1"` {
+		t.Errorf("expect If-None-Match %q, got %q", `"r1"`, r.ifNoneMatch)
+	}
+	if !n.IsNotModified || !n.IsUnchanged {
+		t.Errorf("expect archive to be not modified and unchanged, got %v and %v", n.IsNotModified, n.IsUnchanged)
+	}
+	if _, err := os.Stat(mark); err != nil {
+		t.Errorf("package is extracted again: %v", err)
+	}
+}
+
+func TestDownloadGopmUnchanged(t *testing.T) {
+	r := newTestRegistry(t)
+	setupTestHome(t, r.URL)
+	defer func(excludes []string) { setting.Excludes = excludes }(setting.Excludes)
+	r.serve("r1", newTestZip(t, map[string]string{
+		"com-master/com.go":     "package com",
+		"com-master/README.md":  "com",
+		"com-master/testdata/a": "a",
+	}), http.StatusOK)
+
+	tests := []struct {
+		excludes    []string
+		isUnchanged bool
+		hasReadme   bool
+	}{
+		{nil, false, true},
+		{nil, true, true},
+		{[]string{"*.md"}, false, false},
+		{[]string{"*.md"}, true, false},
+		{[]string{"testdata", "*.md"}, false, false},
+		{[]string{"*.md", "testdata"}, true, false},
+		{nil, false, true},
+	}
+	for i, test := range tests {
+		setting.Excludes = test.excludes
+		n := NewNode("github.com/Unknwon/com", BRANCH, "", false)
+		if err := n.DownloadGopm(newTestContext("update")); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if n.IsUnchanged != test.isUnchanged {
+			t.Errorf("%d: expect unchanged to be %v with excludes %v, got %v", i, test.isUnchanged, test.excludes, n.IsUnchanged)
+		}
+		if _, err := os.Stat(path.Join(n.InstallPath, "README.md")); os.IsNotExist(err) == test.hasReadme {
+			t.Errorf("%d: expect README.md to exist: %v, got %v", i, test.hasReadme, err)
+		}
+	}
+}
+
+func TestParseMetaRepoURL(t *testing.T) {
+	tests := []struct {
+		repoURL  string
+		insecure bool
+		isValid  bool
+	}{
+		{"https://example.com/repo", false, true},
+		{"ssh://git@example.com/repo", false, true},
+		{"git+ssh://git@example.com/repo", false, true},
+		{"http://example.com/repo", false, false},
+		{"http://example.com/repo", true, true},
+		{"ext::ssh://example.com/repo", false, false},
+		{"file:///etc", false, false},
+		{"-uhttps://example.com/repo", false, false},
+		{"--upload-pack=touch://example.com/repo", false, false},
+	}
+	defer func(insecure bool) { IsInsecure = insecure }(IsInsecure)
+	for _, test := range tests {
+		IsInsecure = test.insecure
+		html := `<html><head><meta name="go-import" content="example.com/repo git ` + test.repoURL + `"></head></html>`
+		match, err := parseMeta("https", "example.com/repo", strings.NewReader(html))
+		if test.isValid && err != nil {
+			t.Errorf("parseMeta(%q, insecure=%v): unexpected error: %v", test.repoURL, test.insecure, err)
+		} else if !test.isValid && err == nil {
+			t.Errorf("parseMeta(%q, insecure=%v): expect error but got repoURL %q", test.repoURL, test.insecure, match["repoURL"])
+		}
+	}
+}
+
+// Unknown host has no root path rule, so its root comes from go-import meta tag.
+func TestDiscoverRootUnknownHost(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><meta name="go-import" content="vanity.example.com/x/y git https://git.example.com/y"></head></html>`)
+	}))
+	defer server.Close()
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return new(net.Dialer).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	n := NewNode("vanity.example.com/x/y/sub", BRANCH, "", true)
+	if n.RootPath != "vanity.example.com/x/y/sub" {
+		t.Fatalf("NewNode: expect root path of import path, got %q", n.RootPath)
+	}
+	n.Client = &http.Client{Transport: transport}
+	if err := n.DiscoverRoot(); err != nil {
+		t.Fatalf("DiscoverRoot: %v", err)
+	}
+	if n.RootPath != "vanity.example.com/x/y" || n.RepoURL != "https://git.example.com/y" {
+		t.Errorf("DiscoverRoot: expect root vanity.example.com/x/y of https://git.example.com/y, got %q of %q", n.RootPath, n.RepoURL)
+	}
+}
+
+func TestCopyToGopathReplace(t *testing.T) {
+	setupTestHome(t, "")
+	defer func(gopath string) { setting.InstallGopath = gopath }(setting.InstallGopath)
+	setting.InstallGopath = path.Join(setting.HomeDir, "go/src")
+
+	n := NewNode("github.com/Unknwon/com", BRANCH, "", false)
+	files := map[string]string{
+		path.Join(n.InstallPath, "com.go"):          "package com",
+		path.Join(n.InstallGopath, "com.go"):        "package old",
+		path.Join(n.InstallGopath, "old.go"):        "package old",
+		path.Join(n.InstallGopath, "testdata/a.in"): "old",
+	}
+	for name, body := range files {
+		os.MkdirAll(path.Dir(name), os.ModePerm)
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := n.CopyToGopath(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"old.go", "testdata"} {
+		if _, err := os.Stat(path.Join(n.InstallGopath, name)); !os.IsNotExist(err) {
+			t.Errorf("%s of old package in GOPATH is not removed: %v", name, err)
+		}
+	}
+	if data, err := ioutil.ReadFile(path.Join(n.InstallGopath, "com.go")); err != nil {
+		t.Error(err)
+	} else if string(data) != "package com" {
+		t.Errorf("com.go in GOPATH is not replaced: %q", data)
+	}
+}
+
+func TestDownloadGopmLayout(t *testing.T) {
+	tests := []struct {
+		layout string
+		files  map[string]string
+	}{
+		{"wrapped", map[string]string{
+			"com-master/com.go":   "package com",
+			"com-master/sub/a.go": "package sub",
+		}},
+		{"flat", map[string]string{
+			"com.go":   "package com",
+			"sub/a.go": "package sub",
+		}},
+		{"flat with single file", map[string]string{
+			"com.go": "package com",
+		}},
+	}
+	for _, test := range tests {
+		r := newTestRegistry(t)
+		setupTestHome(t, r.URL)
+		r.serve("r1", newTestZip(t, test.files), http.StatusOK)
+
+		n := NewNode("github.com/Unknwon/com", BRANCH, "", false)
+		if err := n.DownloadGopm(newTestContext()); err != nil {
+			t.Errorf("%s: %v", test.layout, err)
+			continue
+		}
+		for name, body := range test.files {
+			if test.layout == "wrapped" {
+				name = strings.TrimPrefix(name, "com-master/")
+			}
+			if data, err := ioutil.ReadFile(path.Join(n.InstallPath, name)); err != nil {
+				t.Errorf("%s: %v", test.layout, err)
+			} else if string(data) != body {
+				t.Errorf("%s: expect %s to be %q, got %q", test.layout, name, body, data)
+			}
+		}
+	}
+}
+
+func TestFetchArchiveStatus(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		isRetry bool
+		err     string
+	}{
+		{http.StatusNotFound, "<html>not here</html>", false, "404 Not Found"},
+		{http.StatusNotFound, `{"error":"package not found"}`, false, "404 Not Found - package not found"},
+		{http.StatusInternalServerError, "<html>oops</html>", true, "500 Internal Server Error"},
+	}
+	for _, test := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+		url := srv.URL + "/com.zip"
+		localPath := path.Join(t.TempDir(), "com.zip")
+
+		_, _, isRetry, err := fetchArchive(HttpClient, url, localPath, 0, nil)
+		srv.Close()
+		if err == nil {
+			t.Errorf("%d: expect error, got nil", test.status)
+			continue
+		}
+		if !strings.Contains(err.Error(), url) || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%d: expect error with %s and %q, got %q", test.status, url, test.err, err)
+		}
+		if isRetry != test.isRetry {
+			t.Errorf("%d: expect retry to be %v, got %v", test.status, test.isRetry, isRetry)
+		}
+		if _, err = os.Stat(localPath); !os.IsNotExist(err) {
+			t.Errorf("%d: archive file is created for error response: %v", test.status, err)
+		}
+	}
+}
+
+func TestFetchArchiveBrokenBody(t *testing.T) {
+	archive := bytes.Repeat([]byte("gopm"), 1024)
+	var isBroken bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !isBroken {
+			// Connection drops in the middle of body.
+			isBroken = true
+			w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+			w.Write(archive[:len(archive)/2])
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		http.ServeContent(w, req, "com.zip", time.Time{}, bytes.NewReader(archive))
+	}))
+	defer srv.Close()
+	localPath := path.Join(t.TempDir(), "com.zip")
+
+	_, _, isRetry, err := fetchArchive(HttpClient, srv.URL, localPath, 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "fail to save archive") {
+		t.Fatalf("expect error of saving archive, got %v", err)
+	}
+	if !isRetry {
+		t.Error("expect broken download to be retried")
+	}
+
+	// Next try resumes from partial file and gets the same archive.
+	sum, _, _, err := fetchArchive(HttpClient, srv.URL, localPath, int64(len(archive)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := fmt.Sprintf("%x", sha256.Sum256(archive)); sum != expect {
+		t.Errorf("expect checksum %s, got %s", expect, sum)
+	}
+	if data, err := ioutil.ReadFile(localPath); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(data, archive) {
+		t.Errorf("expect archive of %d bytes, got %d bytes", len(archive), len(data))
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"go/build"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
@@ -45,6 +46,9 @@ func ParseTarget(target string) string {
 	return "."
 }
 
+// joinPath returns first num segments of given import path.
+// Import paths always use forward slashes regardless of platform,
+// so it must not be used for building file system paths.
 func joinPath(name string, num int) string {
 	subdirs := strings.Split(name, "/")
 	if len(subdirs) > num {
@@ -53,10 +57,37 @@ func joinPath(name string, num int) string {
 	return name
 }
 
+// joinFilePath joins elements into file system path by rules of current platform,
+// which keeps UNC prefix on Windows, and returns it with forward slashes
+// as all other paths in gopm. Use joinPath for import paths instead.
+func joinFilePath(elem ...string) string {
+	return filepath.ToSlash(filepath.Join(elem...))
+}
+
 var gopkgPathPattern = regexp.MustCompile(`^/(?:([a-zA-Z0-9][-a-zA-Z0-9]+)/)?([a-zA-Z][-.a-zA-Z0-9]*)\.((?:v0|v[1-9][0-9]*)(?:\.0|\.[1-9][0-9]*){0,2})(?:\.git)?((?:/[a-zA-Z0-9][-.a-zA-Z0-9]*)*)$`)
 
-// GetRootPath returns project root path.
+// GopkgMajor returns major version(e.g. 'v2') encoded in gopkg.in import path,
+// or empty string if it is not a valid gopkg.in path.
+func GopkgMajor(importPath string) string {
+	if !strings.HasPrefix(importPath, "gopkg.in/") {
+		return ""
+	}
+	m := gopkgPathPattern.FindStringSubmatch(strings.TrimPrefix(importPath, "gopkg.in"))
+	if m == nil {
+		return ""
+	}
+	return strings.Split(m[3], ".")[0]
+}
+
+// GetRootPath returns project root path by rules of known hosts,
+// import path is returned as it is for unknown host,
+// whose root is found by go-import meta tag in DiscoverRoot.
 func GetRootPath(name string) string {
+	// Personal branch of Launchpad: launchpad.net/~user/project/branch.
+	if strings.HasPrefix(name, "launchpad.net/~") {
+		return joinPath(name, 4)
+	}
+
 	for prefix, num := range setting.RootPathPairs {
 		if strings.HasPrefix(name, prefix) {
 			return joinPath(name, num)
@@ -248,8 +279,13 @@ func init() {
 }
 
 // IsGoRepoPath returns true if package is from standard library.
+// Packages not in the list are considered as standard as well when
+// the first path element has no dot, since remote paths must have a host.
 func IsGoRepoPath(importPath string) bool {
-	return goRepoPath[importPath]
+	if goRepoPath[importPath] {
+		return true
+	}
+	return !strings.Contains(strings.Split(importPath, "/")[0], ".")
 }
 
 // ListImports checks and returns a list of imports of given import path and options.
@@ -284,15 +320,20 @@ func ListImports(importPath, rootPath, vendorPath, srcPath, tags string, isTest
 	}
 	imports := make([]string, 0, numImports)
 	for _, name := range rawImports {
-		if IsGoRepoPath(name) {
-			continue
-		} else if strings.HasPrefix(name, rootPath) {
+		// Subpackages of project itself may have no dot in path as well.
+		if len(rootPath) > 0 && strings.HasPrefix(name, rootPath) {
+			if IsIgnoredDir(strings.TrimPrefix(name, rootPath)) {
+				log.Debug("Skipped ignored subpackage: %s", name)
+				continue
+			}
 			moreImports, err := ListImports(name, rootPath, vendorPath, srcPath, tags, isTest)
 			if err != nil {
 				return nil, err
 			}
 			imports = append(imports, moreImports...)
 			continue
+		} else if IsGoRepoPath(name) {
+			continue
 		}
 		if setting.Debug {
 			log.Debug("Found dependency: %s", name)
@@ -302,6 +343,54 @@ func ListImports(importPath, rootPath, vendorPath, srcPath, tags string, isTest
 	return imports, nil
 }
 
+// IsIgnoredDir returns true if any element of given relative path is
+// ignored by go tool, i.e. hidden, starts with '_' or is 'testdata',
+// code in them is bundled rather than imported so it does not count.
+func IsIgnoredDir(relPath string) bool {
+	for _, name := range strings.Split(relPath, "/") {
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseExcludes splits comma-separated glob patterns,
+// and returns error if any of them is malformed.
+func ParseExcludes(val string) ([]string, error) {
+	patterns := make([]string, 0, 3)
+	for _, p := range strings.Split(val, ",") {
+		p = strings.Trim(strings.TrimSpace(p), "/")
+		if len(p) == 0 {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern(%s): %v", p, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// IsExcluded returns true if given relative path or any of its parent
+// directories matches one of patterns. Pattern without slash matches
+// one path segment at any level, e.g. 'node_modules'.
+func IsExcluded(name string, patterns []string) bool {
+	segs := strings.Split(strings.Trim(name, "/"), "/")
+	for _, p := range patterns {
+		hasSlash := strings.Contains(p, "/")
+		for i := range segs {
+			if ok, _ := path.Match(p, strings.Join(segs[:i+1], "/")); ok {
+				return true
+			}
+			if ok, _ := path.Match(p, segs[i]); ok && !hasSlash {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // GetVcsName checks whether dirPath has .git .hg .svn else return ""
 func GetVcsName(dirPath string) string {
 	switch {
@@ -309,6 +398,8 @@ func GetVcsName(dirPath string) string {
 		return "git"
 	case base.IsExist(path.Join(dirPath, ".hg")):
 		return "hg"
+	case base.IsExist(path.Join(dirPath, ".bzr")):
+		return "bzr"
 	case base.IsExist(path.Join(dirPath, ".svn")):
 		return "svn"
 	}
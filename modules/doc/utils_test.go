@@ -0,0 +1,105 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		num    int
+		expect string
+	}{
+		{"github.com/Unknwon/com", 3, "github.com/Unknwon/com"},
+		{"github.com/Unknwon/com/sub/pkg", 3, "github.com/Unknwon/com"},
+		{"launchpad.net/~user/project/branch/sub", 4, "launchpad.net/~user/project/branch"},
+		{"golang.org/x", 3, "golang.org/x"},
+	}
+	for _, test := range tests {
+		if actual := joinPath(test.name, test.num); actual != test.expect {
+			t.Errorf("joinPath(%q, %d) = %q, expect %q", test.name, test.num, actual, test.expect)
+		}
+	}
+}
+
+func TestGetRootPath(t *testing.T) {
+	tests := []struct {
+		importPath string
+		expect     string
+	}{
+		{"github.com/Unknwon/com", "github.com/Unknwon/com"},
+		{"github.com/Unknwon/macaron/inject", "github.com/Unknwon/macaron"},
+		{"launchpad.net/goamz/aws", "launchpad.net/goamz"},
+		{"launchpad.net/~user/project/branch/sub", "launchpad.net/~user/project/branch"},
+		{"gopkg.in/yaml.v2", "gopkg.in/yaml.v2"},
+		{"gopkg.in/check.v1/sub", "gopkg.in/check.v1"},
+		{"code.google.com/p/x", "code.google.com/p/x"},
+		{"code.google.com/p/x/sub", "code.google.com/p/x"},
+		// Root of unknown host is found by go-import meta tag later.
+		{"example.com/x/y/sub", "example.com/x/y/sub"},
+	}
+	for _, test := range tests {
+		if actual := GetRootPath(test.importPath); actual != test.expect {
+			t.Errorf("GetRootPath(%q) = %q, expect %q", test.importPath, actual, test.expect)
+		}
+	}
+}
+
+// Import paths are joined onto GOPATH and local repository which have been
+// converted to forward slashes, so install paths never mix separators.
+func TestInstallPathWindowsGopath(t *testing.T) {
+	defer func(gopath, repoPath string) {
+		setting.InstallGopath, setting.InstallRepoPath = gopath, repoPath
+	}(setting.InstallGopath, setting.InstallRepoPath)
+
+	tests := []struct {
+		gopath, repoPath string
+		importPath       string
+		tp               RevisionType
+		val              string
+		expectGopath     string
+		expectPath       string
+		isWindowsOnly    bool // UNC path only has its meaning on Windows.
+	}{
+		{"C:/Users/joe/go/src", "C:/Users/joe/.gopm/repos", "github.com/Unknwon/com", BRANCH, "",
+			"C:/Users/joe/go/src/github.com/Unknwon/com", "C:/Users/joe/.gopm/repos/github.com/Unknwon/com", false},
+		{"D:/work/go/src", "D:/gopm", "github.com/Unknwon/macaron/inject", TAG, "v1.0.0",
+			"D:/work/go/src/github.com/Unknwon/macaron", "D:/gopm/github.com/Unknwon/macaron.v1.0.0", false},
+		{"//server/share/go/src", "C:/gopm", "golang.org/x/net", COMMIT, "abc123",
+			"//server/share/go/src/golang.org/x/net", "C:/gopm/golang.org/x/net.abc123", true},
+	}
+	for _, test := range tests {
+		if test.isWindowsOnly && runtime.GOOS != "windows" {
+			continue
+		}
+		setting.InstallGopath, setting.InstallRepoPath = test.gopath, test.repoPath
+		n := NewNode(test.importPath, test.tp, test.val, false)
+		if n.InstallGopath != test.expectGopath {
+			t.Errorf("InstallGopath of %s = %q, expect %q", test.importPath, n.InstallGopath, test.expectGopath)
+		}
+		if n.InstallPath != test.expectPath {
+			t.Errorf("InstallPath of %s = %q, expect %q", test.importPath, n.InstallPath, test.expectPath)
+		}
+		if strings.Contains(n.InstallGopath+n.InstallPath, "\\") {
+			t.Errorf("Install paths of %s mix separators: %q, %q", test.importPath, n.InstallGopath, n.InstallPath)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package doc
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gpmgo/gopm/modules/base"
+	"github.com/gpmgo/gopm/modules/log"
+	"github.com/gpmgo/gopm/modules/setting"
+)
+
+// LATEST is the special tag value that resolves to the newest tag.
+const LATEST = "latest"
+
+// IsVersionConstraint returns true if given tag value needs to be resolved
+// against available tags, i.e. 'latest' or '>=1.2.0'.
+func IsVersionConstraint(val string) bool {
+	return val == LATEST || strings.HasPrefix(val, ">=")
+}
+
+// parseVersion parses version string like 'v1.2.3' into numeric parts,
+// it returns false if given string is not a version.
+func parseVersion(ver string) ([]int, bool) {
+	ver = strings.TrimPrefix(ver, "v")
+	if len(ver) == 0 {
+		return nil, false
+	}
+	infos := strings.Split(ver, ".")
+	nums := make([]int, len(infos))
+	for i, info := range infos {
+		num, err := strconv.Atoi(info)
+		if err != nil {
+			return nil, false
+		}
+		nums[i] = num
+	}
+	return nums, true
+}
+
+// compareVersion returns -1, 0 or 1 when a is less than, equal to or greater than b.
+func compareVersion(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// getMetadata returns cached metadata of given package and key,
+// it returns false if not found, expired or user asked to refresh.
+func getMetadata(rootPath, key string) (string, bool) {
+	if setting.Metadata == nil || setting.RefreshMetadata {
+		return "", false
+	}
+	updated := setting.Metadata.MustInt64(rootPath, key+"_updated")
+	if time.Since(time.Unix(updated, 0)) > setting.MetadataTTL {
+		return "", false
+	}
+	val, err := setting.Metadata.GetValue(rootPath, key)
+	return val, err == nil
+}
+
+// setMetadata caches metadata of given package and key.
+func setMetadata(rootPath, key, value string) {
+	if setting.Metadata == nil {
+		return
+	}
+	setting.Metadata.SetValue(rootPath, key, value)
+	setting.Metadata.SetValue(rootPath, key+"_updated", base.ToStr(time.Now().Unix()))
+	if err := setting.SaveMetadata(); err != nil {
+		log.Warn("Fail to cache metadata: %v", err)
+	}
+}
+
+// ListTags returns all tags that remote repository of given import path exposes,
+// result is cached for a while to save network round-trips.
+func ListTags(rootPath string) ([]string, error) {
+	if val, ok := getMetadata(rootPath, "tags"); ok {
+		return strings.Fields(val), nil
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git is required to list tags but not found in PATH")
+	}
+
+	stdout, stderr, err := base.ExecCmd("git", "ls-remote", "--tags", "https://"+rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-remote: %v - %s", err, stderr)
+	}
+
+	tags := make([]string, 0, 10)
+	for _, line := range strings.Split(stdout, "\n") {
+		infos := strings.Fields(line)
+		if len(infos) != 2 || strings.HasSuffix(infos[1], "^{}") {
+			continue
+		}
+		tags = append(tags, strings.TrimPrefix(infos[1], "refs/tags/"))
+	}
+	setMetadata(rootPath, "tags", strings.Join(tags, " "))
+	return tags, nil
+}
+
+// ResolveTag returns the newest tag in given list that satisfies constraint.
+func ResolveTag(constraint string, tags []string) (string, error) {
+	var min []int
+	if constraint != LATEST {
+		var ok bool
+		min, ok = parseVersion(strings.TrimSpace(strings.TrimPrefix(constraint, ">=")))
+		if !ok {
+			return "", fmt.Errorf("invalid version constraint: %s", constraint)
+		}
+	}
+
+	var best string
+	var bestVer []int
+	for _, tag := range tags {
+		ver, ok := parseVersion(tag)
+		if !ok || (min != nil && compareVersion(ver, min) < 0) {
+			continue
+		}
+		if bestVer == nil || compareVersion(ver, bestVer) > 0 {
+			best, bestVer = tag, ver
+		}
+	}
+	if len(best) == 0 {
+		return "", fmt.Errorf("no tag matches version constraint: %s", constraint)
+	}
+	return best, nil
+}
+
+// ResolveVersion resolves version constraint of node to an exact tag,
+// it does nothing if node is not a tag or has an exact value.
+func (n *Node) ResolveVersion() error {
+	if n.Type != TAG || !IsVersionConstraint(n.Value) {
+		return nil
+	}
+
+	tags, err := ListTags(n.RootPath)
+	if err != nil {
+		return err
+	}
+
+	// Version of gopkg.in package must match major version in its path.
+	if major := GopkgMajor(n.RootPath); len(major) > 0 {
+		majorVer, _ := parseVersion(major)
+		matched := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			if ver, ok := parseVersion(tag); ok && ver[0] == majorVer[0] {
+				matched = append(matched, tag)
+			}
+		}
+		tags = matched
+	}
+	tag, err := ResolveTag(n.Value, tags)
+	if err != nil {
+		return err
+	}
+	log.Info("Resolved %s@%s:%s to tag: %s", n.RootPath, n.Type, n.Value, tag)
+	n.Value = tag
+	n.setInstallPath()
+	return nil
+}
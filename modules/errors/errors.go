@@ -15,9 +15,14 @@
 package errors
 
 import (
+	"sync"
+
 	"github.com/gpmgo/gopm/modules/setting"
 )
 
+// Errors can be set from multiple goroutines when getting packages.
+var lock sync.Mutex
+
 type ErrDownload struct {
 	pkgName string
 }
@@ -55,11 +60,15 @@ func NewErrCopyResource(name string) ErrCopyResource {
 }
 
 func SetError(err error) {
+	lock.Lock()
+	defer lock.Unlock()
 	setting.RuntimeError.HasError = true
 	setting.RuntimeError.Fatal = err
 }
 
 func AppendError(err error) {
+	lock.Lock()
+	defer lock.Unlock()
 	setting.RuntimeError.HasError = true
 	setting.RuntimeError.Errors = append(setting.RuntimeError.Errors, err)
 }
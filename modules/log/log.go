@@ -29,7 +29,8 @@ const (
 
 var (
 	Verbose, NonColor bool
-	Output            io.Writer = os.Stdout
+	Quiet             bool                  // Only errors are printed in quiet mode.
+	Output            io.Writer = os.Stderr // Keep stdout for data output of commands.
 
 	LEVEL_FLAGS = [...]string{"DEBUG", " INFO", " WARN", "ERROR", "FATAL"}
 )
@@ -40,6 +41,24 @@ func init() {
 	}
 }
 
+// CanColor returns true if color output is proper for given writer,
+// which means it is a terminal and NO_COLOR environment variable is not set.
+func CanColor(w io.Writer) bool {
+	if runtime.GOOS == "windows" || len(os.Getenv("NO_COLOR")) > 0 {
+		return false
+	}
+
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
 const (
 	DEBUG = iota
 	INFO
@@ -49,7 +68,7 @@ const (
 )
 
 func Print(level int, format string, args ...interface{}) {
-	if !Verbose && level < WARNING {
+	if (!Verbose && level < WARNING) || (Quiet && level < ERROR) {
 		return
 	}
 
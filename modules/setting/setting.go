@@ -20,6 +20,8 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gpmgo/gopm/modules/base"
 	"github.com/gpmgo/gopm/modules/goconfig"
@@ -31,6 +33,18 @@ type Error struct {
 	Errors   []error
 }
 
+// Error returns messages of fatal error and all other errors.
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Errors)+1)
+	if e.Fatal != nil {
+		msgs = append(msgs, e.Fatal.Error())
+	}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
 type Option struct {
 }
 
@@ -38,6 +52,7 @@ const (
 	VERSION     = 201602010
 	VENDOR      = ".vendor"
 	GOPMFILE    = ".gopmfile"
+	GOPMLOCK    = "gopm.lock"
 	PKGNAMELIST = "pkgname.list"
 	VERINFO     = "data/VERSION.json"
 )
@@ -45,6 +60,7 @@ const (
 const (
 	URL_API_DOWNLOAD = "/api/v1/download"
 	URL_API_REVISION = "/api/v1/revision"
+	URL_API_SEARCH   = "/api/v1/search"
 )
 
 var (
@@ -53,14 +69,32 @@ var (
 	WorkDir          string // The path of gopm was executed.
 	PkgNameListFile  string
 	LocalNodesFile   string
+	MetadataFile     string
 	DefaultGopmfile  string
 	DefaultVendor    string
 	DefaultVendorSrc string
 	InstallRepoPath  string // The gopm local repository.
 	InstallGopath    string
 	HttpProxy        string
+	Authorization    string // Authorization header to access private registry.
+	ConfigGopath     string // GOPATH in config file.
+	ConfigReposPath  string // Local repository path in config file.
 	RegistryURL      string = "https://gopm.io"
 
+	// Download settings.
+	MaxRetries                   = 3               // Maximum number of attempts to download an archive.
+	DownloadTimeout              = 5 * time.Minute // Maximum idle time of downloading an archive.
+	MetadataTTL                  = time.Hour       // Maximum age of cached metadata from remote.
+	MaxExtractSize               = int64(1 << 30)  // Maximum total bytes extracted from an archive.
+	MaxExtractFiles              = 100000          // Maximum number of entries extracted from an archive.
+	MaxIdleConnsPerHost          = 4               // Maximum idle connections kept to each host for reuse.
+	RefreshMetadata     bool                       // Ignore cached metadata and fetch again.
+	NoCache             bool                       // Delete downloaded archive after extraction.
+	SkipDiskCheck       bool                       // Do not check free disk space before extraction.
+	Excludes            []string                   // Glob patterns of files to skip when extracting.
+	Mirrors             []string                   // Base URLs of registry mirrors to try before default one.
+	FlatLayout          bool                       // Extract packages into GOPATH by plain import path.
+
 	// System settings.
 	IsWindows        bool
 	IsWindowsXP      bool
@@ -76,14 +110,18 @@ var (
 	Cfg             *goconfig.ConfigFile
 	PackageNameList = make(map[string]string)
 	LocalNodes      *goconfig.ConfigFile
+	Metadata        *goconfig.ConfigFile
+	metadataLock    sync.Mutex
+	URLTemplates    map[string]string // Templates of archive URL keyed by host.
 
 	// TODO: configurable.
 	RootPathPairs = map[string]int{
-		"github.com":      3,
-		"bitbucket.org":   3,
-		"git.oschina.net": 3,
-		"launchpad.net":   2,
-		"golang.org":      3,
+		"github.com":        3,
+		"bitbucket.org":     3,
+		"git.oschina.net":   3,
+		"launchpad.net":     2,
+		"golang.org":        3,
+		"code.google.com/p": 3,
 	}
 	CommonRes = []string{"views", "templates", "static", "public", "conf"}
 )
@@ -109,6 +147,34 @@ func SaveGopmfile(gf *goconfig.ConfigFile, fileName string) error {
 	return nil
 }
 
+// ParseMirrors splits comma-separated base URLs of registry mirrors.
+func ParseMirrors(val string) []string {
+	mirrors := make([]string, 0, 3)
+	for _, m := range strings.Split(val, ",") {
+		if m = strings.TrimRight(strings.TrimSpace(m), "/"); len(m) > 0 {
+			mirrors = append(mirrors, m)
+		}
+	}
+	return mirrors
+}
+
+// RegistryURLs returns base URLs of registry in the order to be tried,
+// default registry always comes last unless it is listed as a mirror.
+func RegistryURLs() []string {
+	urls := make([]string, 0, len(Mirrors)+1)
+	hasDefault := false
+	for _, m := range Mirrors {
+		if m == RegistryURL {
+			hasDefault = true
+		}
+		urls = append(urls, m)
+	}
+	if !hasDefault {
+		urls = append(urls, RegistryURL)
+	}
+	return urls
+}
+
 // LoadConfig loads gopm global configuration.
 func LoadConfig() (err error) {
 	if !base.IsExist(ConfigFile) {
@@ -124,6 +190,41 @@ func LoadConfig() (err error) {
 	}
 
 	HttpProxy = Cfg.MustValue("settings", "HTTP_PROXY")
+	Authorization = Cfg.MustValue("settings", "AUTHORIZATION")
+	MaxRetries = Cfg.MustInt("settings", "MAX_RETRIES", MaxRetries)
+	if MaxRetries < 1 {
+		MaxRetries = 1
+	}
+	ConfigGopath = Cfg.MustValue("settings", "GOPATH")
+	ConfigReposPath = Cfg.MustValue("settings", "REPOS_PATH")
+	NoCache = Cfg.MustBool("settings", "NO_CACHE")
+	MaxExtractSize = Cfg.MustInt64("settings", "MAX_EXTRACT_SIZE", MaxExtractSize)
+	MaxExtractFiles = Cfg.MustInt("settings", "MAX_EXTRACT_FILES", MaxExtractFiles)
+	MaxIdleConnsPerHost = Cfg.MustInt("settings", "MAX_IDLE_CONNS_PER_HOST", MaxIdleConnsPerHost)
+	if MaxIdleConnsPerHost < 1 {
+		MaxIdleConnsPerHost = 1
+	}
+	Mirrors = ParseMirrors(Cfg.MustValue("settings", "MIRRORS"))
+	if tpls, err := Cfg.GetSection("url_templates"); err == nil {
+		URLTemplates = tpls
+	}
+	if ttl := Cfg.MustValue("settings", "METADATA_TTL"); len(ttl) > 0 {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid METADATA_TTL setting: %v", err)
+		}
+		MetadataTTL = d
+	}
+	if timeout := Cfg.MustValue("settings", "TIMEOUT"); len(timeout) > 0 {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid TIMEOUT setting: %v", err)
+		} else if d <= 0 {
+			// Zero timeout would close every response before reading it.
+			return fmt.Errorf("invalid TIMEOUT setting: %s is not positive", timeout)
+		}
+		DownloadTimeout = d
+	}
 	return nil
 }
 
@@ -193,6 +294,29 @@ func LoadLocalNodes() (err error) {
 	return nil
 }
 
+func LoadMetadata() (err error) {
+	if !base.IsFile(MetadataFile) {
+		os.MkdirAll(path.Dir(MetadataFile), os.ModePerm)
+		os.Create(MetadataFile)
+	}
+
+	Metadata, err = goconfig.LoadConfigFile(MetadataFile)
+	if err != nil {
+		return fmt.Errorf("fail to load metadata.list: %v", err)
+	}
+	return nil
+}
+
+// SaveMetadata saves metadata cache, it is safe for concurrent use.
+func SaveMetadata() error {
+	metadataLock.Lock()
+	defer metadataLock.Unlock()
+	if err := goconfig.SaveConfigFile(Metadata, MetadataFile); err != nil {
+		return fmt.Errorf("fail to save metadata.list: %v", err)
+	}
+	return nil
+}
+
 func SaveLocalNodes() error {
 	if err := goconfig.SaveConfigFile(LocalNodes, LocalNodesFile); err != nil {
 		return fmt.Errorf("fail to save localnodes.list: %v", err)
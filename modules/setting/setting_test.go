@@ -0,0 +1,66 @@
+// Copyright 2014 Unknwon
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package setting
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigTimeout(t *testing.T) {
+	defer func(configFile string, timeout time.Duration) {
+		ConfigFile, DownloadTimeout = configFile, timeout
+	}(ConfigFile, DownloadTimeout)
+
+	tests := []struct {
+		timeout string
+		expect  time.Duration
+		isValid bool
+	}{
+		{"", time.Minute, true},
+		{"30s", 30 * time.Second, true},
+		{"2m", 2 * time.Minute, true},
+		{"0s", 0, false},
+		{"0", 0, false},
+		{"-5s", 0, false},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		ConfigFile = path.Join(t.TempDir(), "gopm.ini")
+		data := "[settings]\n"
+		if len(test.timeout) > 0 {
+			data += "TIMEOUT = " + test.timeout + "\n"
+		}
+		if err := ioutil.WriteFile(ConfigFile, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		DownloadTimeout = time.Minute
+
+		err := LoadConfig()
+		if !test.isValid {
+			if err == nil {
+				t.Errorf("TIMEOUT %q: expect error, got timeout %v", test.timeout, DownloadTimeout)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("TIMEOUT %q: unexpected error: %v", test.timeout, err)
+		} else if DownloadTimeout != test.expect {
+			t.Errorf("TIMEOUT %q: expect %v, got %v", test.timeout, test.expect, DownloadTimeout)
+		}
+	}
+}